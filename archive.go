@@ -0,0 +1,511 @@
+package unisrv
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxInflatedCacheSize is the maximum total size of decompressed zip entries kept in memory.
+const maxInflatedCacheSize = 256 << 20
+
+// archiveExts is the list of supported archive file extensions.
+var archiveExts = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// IsArchive reports whether the named file has a supported archive extension.
+func IsArchive(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Archive is a read-only file system backed by a zip, tar or tar.gz archive.
+//
+// The entries are indexed when the archive is opened and served without extracting to disk.
+// Stored zip entries and tar entries are read from the archive directly,
+// while entries of tar.gz archives are kept in memory.
+// Deflated zip entries are decompressed when first read, and the recently used contents are cached up to 256 MiB
+// since a request reads the same file several times.
+// If the archive contains a single top-level directory, it is used as the root.
+type Archive struct {
+	root     *archiveEntry
+	closer   io.Closer
+	inflated *inflatedCache
+}
+
+// OpenArchive opens the named zip, tar or tar.gz archive.
+func OpenArchive(name string) (*Archive, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("open archive: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("stat archive: %w", err)
+	}
+
+	a := &Archive{
+		root:     newArchiveDir(".", info.ModTime()),
+		inflated: newInflatedCache(maxInflatedCacheSize),
+	}
+
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		err = a.indexZip(f, info.Size())
+		a.closer = f
+	case strings.HasSuffix(lower, ".tar"):
+		err = a.indexTar(f)
+		a.closer = f
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		err = a.indexTarGz(f)
+		f.Close()
+	default:
+		err = errors.New("unsupported archive format")
+		f.Close()
+	}
+	if err != nil {
+		if a.closer != nil {
+			a.closer.Close()
+		}
+		return nil, fmt.Errorf("index archive %s: %w", name, err)
+	}
+
+	a.root.sort()
+	a.unwrapTopLevelDir()
+
+	return a, nil
+}
+
+// Open opens the named file.
+func (s *Archive) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	e := s.root
+	if name != "." {
+		for _, elem := range strings.Split(name, "/") {
+			e = e.child(elem)
+			if e == nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+			}
+		}
+	}
+
+	if e.IsDir() {
+		return &archiveDir{entry: e}, nil
+	}
+
+	return &archiveFile{entry: e, name: name}, nil
+}
+
+// Close closes the archive.
+func (s *Archive) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	if err := s.closer.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	return nil
+}
+
+// indexZip indexes entries of the zip archive.
+func (s *Archive) indexZip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("read zip: %w", err)
+	}
+
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			s.addDir(zf.Name, zf.Modified)
+			continue
+		}
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+
+		size := int64(zf.UncompressedSize64)
+		var open func() (io.ReadSeeker, error)
+		if zf.Method == zip.Store {
+			offset, err := zf.DataOffset()
+			if err != nil {
+				return fmt.Errorf("data offset of %s: %w", zf.Name, err)
+			}
+			open = func() (io.ReadSeeker, error) {
+				return io.NewSectionReader(r, offset, size), nil
+			}
+		} else {
+			open = func() (io.ReadSeeker, error) {
+				if b, ok := s.inflated.get(zf); ok {
+					return bytes.NewReader(b), nil
+				}
+
+				rc, err := zf.Open()
+				if err != nil {
+					return nil, fmt.Errorf("open zip entry: %w", err)
+				}
+				defer rc.Close()
+
+				b, err := io.ReadAll(rc)
+				if err != nil {
+					return nil, fmt.Errorf("read zip entry: %w", err)
+				}
+				s.inflated.add(zf, b)
+				return bytes.NewReader(b), nil
+			}
+		}
+
+		s.addFile(zf.Name, zf.Modified, size, open)
+	}
+
+	return nil
+}
+
+// indexTarGz indexes entries of the tar.gz archive.
+func (s *Archive) indexTarGz(r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("read gzip: %w", err)
+	}
+	defer zr.Close()
+
+	return s.indexTar(zr)
+}
+
+// indexTar indexes entries of the tar archive.
+// The contents are read from r directly if it is seekable, e.g. a plain tar file, and loaded into memory otherwise.
+func (s *Archive) indexTar(r io.Reader) error {
+	ra, seekable := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	})
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar: %w", err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			s.addDir(hdr.Name, hdr.ModTime)
+		case tar.TypeReg:
+			if seekable && !isSparseTarEntry(hdr) {
+				// tar.Reader does not read ahead, so the data of the entry starts at the current offset.
+				offset, err := ra.Seek(0, io.SeekCurrent)
+				if err != nil {
+					return fmt.Errorf("data offset of %s: %w", hdr.Name, err)
+				}
+				size := hdr.Size
+				s.addFile(hdr.Name, hdr.ModTime, size, func() (io.ReadSeeker, error) {
+					return io.NewSectionReader(ra, offset, size), nil
+				})
+				continue
+			}
+
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("read %s: %w", hdr.Name, err)
+			}
+			s.addFile(hdr.Name, hdr.ModTime, int64(len(b)), func() (io.ReadSeeker, error) {
+				return bytes.NewReader(b), nil
+			})
+		default:
+			// Links and special files are not served.
+		}
+	}
+}
+
+// isSparseTarEntry reports whether the data of the tar entry is stored sparsely,
+// i.e. it cannot be read from the archive as is.
+func isSparseTarEntry(hdr *tar.Header) bool {
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// inflatedCache is a LRU cache of the contents of decompressed zip entries.
+type inflatedCache struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	// order lists *inflatedEntry from the most recently used.
+	order   *list.List
+	entries map[*zip.File]*list.Element
+}
+
+// inflatedEntry is a cached content of the zip entry.
+type inflatedEntry struct {
+	file *zip.File
+	b    []byte
+}
+
+// newInflatedCache returns a new inflatedCache which keeps contents up to maxSize bytes in total.
+func newInflatedCache(maxSize int64) *inflatedCache {
+	return &inflatedCache{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[*zip.File]*list.Element),
+	}
+}
+
+// get returns the cached content of the zip entry.
+func (s *inflatedCache) get(f *zip.File) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[f]
+	if !ok {
+		return nil, false
+	}
+	s.order.MoveToFront(elem)
+	return elem.Value.(*inflatedEntry).b, true
+}
+
+// add caches the content of the zip entry, evicting the least recently used contents to keep the size.
+// Contents larger than the maximum size are not cached.
+func (s *inflatedCache) add(f *zip.File, b []byte) {
+	size := int64(len(b))
+	if size > s.maxSize {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[f]; ok {
+		return
+	}
+	for s.size+size > s.maxSize {
+		oldest := s.order.Back()
+		e := s.order.Remove(oldest).(*inflatedEntry)
+		delete(s.entries, e.file)
+		s.size -= int64(len(e.b))
+	}
+
+	s.entries[f] = s.order.PushFront(&inflatedEntry{file: f, b: b})
+	s.size += size
+}
+
+// addDir adds the directory entry to the index.
+func (s *Archive) addDir(name string, modTime time.Time) {
+	elems, ok := splitArchivePath(name)
+	if !ok {
+		return
+	}
+
+	e := s.mkdirAll(elems)
+	e.modTime = modTime
+}
+
+// addFile adds the file entry to the index.
+func (s *Archive) addFile(name string, modTime time.Time, size int64, open func() (io.ReadSeeker, error)) {
+	elems, ok := splitArchivePath(name)
+	if !ok || len(elems) == 0 {
+		return
+	}
+
+	dir := s.mkdirAll(elems[:len(elems)-1])
+	base := elems[len(elems)-1]
+	if dir.child(base) != nil {
+		return
+	}
+
+	dir.children = append(dir.children, &archiveEntry{
+		name:    base,
+		modTime: modTime,
+		size:    size,
+		open:    open,
+	})
+}
+
+// mkdirAll returns the directory entry for elems, creating missing parents.
+func (s *Archive) mkdirAll(elems []string) *archiveEntry {
+	e := s.root
+	for _, elem := range elems {
+		c := e.child(elem)
+		if c == nil {
+			c = newArchiveDir(elem, s.root.modTime)
+			e.children = append(e.children, c)
+		}
+		e = c
+	}
+	return e
+}
+
+// unwrapTopLevelDir makes the single top-level directory the root.
+func (s *Archive) unwrapTopLevelDir() {
+	if len(s.root.children) != 1 || !s.root.children[0].IsDir() {
+		return
+	}
+
+	top := s.root.children[0]
+	top.name = "."
+	s.root = top
+}
+
+// splitArchivePath splits the archive entry name into path elements.
+// It reports false if the name cannot be served.
+func splitArchivePath(name string) ([]string, bool) {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		return nil, true
+	}
+	if !fs.ValidPath(name) {
+		return nil, false
+	}
+	return strings.Split(name, "/"), true
+}
+
+// archiveEntry is a file or directory in the archive.
+// It implements both fs.FileInfo and fs.DirEntry.
+type archiveEntry struct {
+	name     string
+	modTime  time.Time
+	size     int64
+	dir      bool
+	children []*archiveEntry
+	open     func() (io.ReadSeeker, error)
+}
+
+// newArchiveDir returns a new directory entry.
+func newArchiveDir(name string, modTime time.Time) *archiveEntry {
+	return &archiveEntry{
+		name:    name,
+		modTime: modTime,
+		dir:     true,
+	}
+}
+
+func (s *archiveEntry) Name() string               { return s.name }
+func (s *archiveEntry) Size() int64                { return s.size }
+func (s *archiveEntry) ModTime() time.Time         { return s.modTime }
+func (s *archiveEntry) IsDir() bool                { return s.dir }
+func (s *archiveEntry) Sys() any                   { return nil }
+func (s *archiveEntry) Type() fs.FileMode          { return s.Mode().Type() }
+func (s *archiveEntry) Info() (fs.FileInfo, error) { return s, nil }
+
+func (s *archiveEntry) Mode() fs.FileMode {
+	if s.dir {
+		return fs.ModeDir | 0o555 //nolint:mnd
+	}
+	return 0o444 //nolint:mnd
+}
+
+// child returns the child entry with the name or nil.
+func (s *archiveEntry) child(name string) *archiveEntry {
+	for _, c := range s.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// sort sorts children by name recursively.
+func (s *archiveEntry) sort() {
+	slices.SortFunc(s.children, func(a, b *archiveEntry) int {
+		return strings.Compare(a.name, b.name)
+	})
+	for _, c := range s.children {
+		c.sort()
+	}
+}
+
+// archiveFile is an opened regular file in the archive.
+// The content is opened on the first read or seek so that opening the file only to stat it is cheap.
+type archiveFile struct {
+	entry *archiveEntry
+	name  string
+	r     io.ReadSeeker
+}
+
+func (s *archiveFile) Stat() (fs.FileInfo, error) { return s.entry, nil }
+func (s *archiveFile) Close() error               { return nil }
+
+func (s *archiveFile) Read(p []byte) (int, error) {
+	if err := s.load(); err != nil {
+		return 0, err
+	}
+	return s.r.Read(p) //nolint:wrapcheck
+}
+
+func (s *archiveFile) Seek(offset int64, whence int) (int64, error) {
+	if err := s.load(); err != nil {
+		return 0, err
+	}
+	return s.r.Seek(offset, whence) //nolint:wrapcheck
+}
+
+// load opens the content of the entry if it has not been opened.
+func (s *archiveFile) load() error {
+	if s.r != nil {
+		return nil
+	}
+
+	r, err := s.entry.open()
+	if err != nil {
+		return &fs.PathError{Op: "read", Path: s.name, Err: err}
+	}
+	s.r = r
+	return nil
+}
+
+// archiveDir is an opened directory in the archive.
+type archiveDir struct {
+	entry  *archiveEntry
+	offset int
+}
+
+func (s *archiveDir) Stat() (fs.FileInfo, error) { return s.entry, nil }
+func (s *archiveDir) Close() error               { return nil }
+
+func (s *archiveDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: s.entry.name, Err: errors.New("is a directory")}
+}
+
+func (s *archiveDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := s.entry.children[s.offset:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	s.offset += len(rest)
+
+	entries := make([]fs.DirEntry, len(rest))
+	for i, c := range rest {
+		entries[i] = c
+	}
+	return entries, nil
+}
@@ -0,0 +1,449 @@
+package unisrv_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+var archiveModTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func TestIsArchive(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected bool
+	}{
+		{name: "build.zip", expected: true},
+		{name: "build.ZIP", expected: true},
+		{name: "build.tar", expected: true},
+		{name: "build.tar.gz", expected: true},
+		{name: "build.tgz", expected: true},
+		{name: "build", expected: false},
+		{name: "build.gz", expected: false},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			if actual := unisrv.IsArchive(v.name); actual != v.expected {
+				tt.Errorf("expected %v, but got %v", v.expected, actual)
+			}
+		})
+	}
+}
+
+func TestOpenArchive(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := []struct {
+		name  string
+		write func(tt *testing.T, name string)
+	}{
+		{
+			name:  "build.zip",
+			write: writeZip,
+		},
+		{
+			name:  "build.tar",
+			write: writeTar,
+		},
+		{
+			name:  "build.tar.gz",
+			write: writeTarGz,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			name := filepath.Join(dir, v.name)
+			v.write(tt, name)
+
+			archive, err := unisrv.OpenArchive(name)
+			if err != nil {
+				tt.Fatalf("failed to open archive: %+v", err)
+			}
+			defer archive.Close()
+
+			tt.Run("fs", func(ttt *testing.T) {
+				if err := fstest.TestFS(archive, "index.html", "Build/Build.wasm.br"); err != nil {
+					ttt.Error(err)
+				}
+			})
+
+			newHandler := func(opts *unisrv.Options) http.Handler {
+				return unisrv.NewHandlerFS(archive, opts)
+			}
+
+			tt.Run("headers", func(ttt *testing.T) {
+				testNewHandler(ttt, newHandler)
+			})
+
+			tt.Run("transcoding", func(ttt *testing.T) {
+				testTranscoding(ttt, newHandler)
+			})
+
+			tt.Run("precompressed siblings", func(ttt *testing.T) {
+				testPrecompressedSiblings(ttt, newHandler)
+			})
+
+			tt.Run("range", func(ttt *testing.T) {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set("Range", "bytes=0-3")
+				w := httptest.NewRecorder()
+
+				newHandler(nil).ServeHTTP(w, r)
+
+				resp := w.Result()
+				defer resp.Body.Close()
+
+				if resp.StatusCode != http.StatusPartialContent {
+					ttt.Errorf("expected %d, but got %d", http.StatusPartialContent, resp.StatusCode)
+				}
+
+				b, err := io.ReadAll(resp.Body)
+				if err != nil {
+					ttt.Fatalf("read failed: %+v", err)
+				}
+				if string(b) != "test" {
+					ttt.Errorf("expected %q, but got %q", "test", string(b))
+				}
+
+				lastModified := resp.Header.Get("Last-Modified")
+				expected := archiveModTime.Format(http.TimeFormat)
+				if lastModified != expected {
+					ttt.Errorf("expected %q, but got %q", expected, lastModified)
+				}
+			})
+		})
+	}
+}
+
+func TestOpenArchiveInflatedCache(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "build.zip")
+	content := strings.Repeat("deflated content\n", 1024)
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("failed to create zip: %+v", err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "index.html", Method: zip.Deflate})
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %+v", err)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatalf("failed to write zip entry: %+v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %+v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close zip: %+v", err)
+	}
+
+	archive, err := unisrv.OpenArchive(name)
+	if err != nil {
+		t.Fatalf("failed to open archive: %+v", err)
+	}
+	defer archive.Close()
+
+	b, err := fs.ReadFile(archive, "index.html")
+	if err != nil {
+		t.Fatalf("read failed: %+v", err)
+	}
+	if string(b) != content {
+		t.Fatalf("expected %q, but got %q", content, string(b))
+	}
+
+	// Break the compressed data so that decompressing the entry again fails.
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		t.Fatalf("failed to open zip: %+v", err)
+	}
+	offset, err := zr.File[0].DataOffset()
+	zr.Close()
+	if err != nil {
+		t.Fatalf("failed to get data offset: %+v", err)
+	}
+	if err := overwriteFile(name, offset, []byte{0xff, 0xff, 0xff, 0xff}); err != nil {
+		t.Fatalf("failed to overwrite zip: %+v", err)
+	}
+
+	for range 3 {
+		b, err := fs.ReadFile(archive, "index.html")
+		if err != nil {
+			t.Fatalf("expected the cached content, but got error: %+v", err)
+		}
+		if string(b) != content {
+			t.Fatalf("expected %q, but got %q", content, string(b))
+		}
+	}
+}
+
+func TestOpenArchiveLazyInflation(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "build.zip")
+	content := strings.Repeat("deflated content\n", 1024)
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("failed to create zip: %+v", err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "index.html", Method: zip.Deflate})
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %+v", err)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatalf("failed to write zip entry: %+v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %+v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close zip: %+v", err)
+	}
+
+	archive, err := unisrv.OpenArchive(name)
+	if err != nil {
+		t.Fatalf("failed to open archive: %+v", err)
+	}
+	defer archive.Close()
+
+	// Break the compressed data so that only decompressing the entry fails.
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		t.Fatalf("failed to open zip: %+v", err)
+	}
+	offset, err := zr.File[0].DataOffset()
+	zr.Close()
+	if err != nil {
+		t.Fatalf("failed to get data offset: %+v", err)
+	}
+	if err := overwriteFile(name, offset, []byte{0xff, 0xff, 0xff, 0xff}); err != nil {
+		t.Fatalf("failed to overwrite zip: %+v", err)
+	}
+
+	file, err := archive.Open("index.html")
+	if err != nil {
+		t.Fatalf("expected open without decompressing, but got error: %+v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatalf("stat failed: %+v", err)
+	}
+	if info.Size() != int64(len(content)) {
+		t.Errorf("expected %d, but got %d", len(content), info.Size())
+	}
+
+	if _, err := io.ReadAll(file); err == nil {
+		t.Errorf("expected decompressing the broken entry to fail on read")
+	}
+}
+
+func TestOpenArchiveTarFromDisk(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "build.tar")
+	// The long name is stored in an extended header preceding the entry.
+	long := strings.Repeat("long/", 30) + "index.html"
+	entries := []struct {
+		name    string
+		content string
+	}{
+		{name: "index.html", content: "original"},
+		{name: long, content: "long name"},
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("failed to create tar: %+v", err)
+	}
+	tw := tar.NewWriter(f)
+	for _, e := range entries {
+		err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: e.name, Size: int64(len(e.content)), Mode: 0o644})
+		if err != nil {
+			t.Fatalf("failed to write tar header: %+v", err)
+		}
+		if _, err := io.WriteString(tw, e.content); err != nil {
+			t.Fatalf("failed to write tar entry: %+v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %+v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close tar: %+v", err)
+	}
+
+	archive, err := unisrv.OpenArchive(name)
+	if err != nil {
+		t.Fatalf("failed to open archive: %+v", err)
+	}
+	defer archive.Close()
+
+	for _, e := range entries {
+		b, err := fs.ReadFile(archive, e.name)
+		if err != nil {
+			t.Fatalf("read failed: %+v", err)
+		}
+		if string(b) != e.content {
+			t.Errorf("expected %q, but got %q", e.content, string(b))
+		}
+	}
+
+	// The entry is read from the archive on disk rather than from memory.
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("failed to read tar: %+v", err)
+	}
+	if err := overwriteFile(name, int64(bytes.Index(data, []byte("original"))), []byte("modified")); err != nil {
+		t.Fatalf("failed to overwrite tar: %+v", err)
+	}
+
+	b, err := fs.ReadFile(archive, "index.html")
+	if err != nil {
+		t.Fatalf("read failed: %+v", err)
+	}
+	if string(b) != "modified" {
+		t.Errorf("expected %q, but got %q", "modified", string(b))
+	}
+}
+
+// overwriteFile writes b into the named file at offset.
+func overwriteFile(name string, offset int64, b []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(b, offset); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// walkTestdata calls fn for each regular file in testdata with its slash separated path.
+func walkTestdata(t *testing.T, fn func(name string, b []byte)) {
+	t.Helper()
+
+	err := fs.WalkDir(os.DirFS("testdata"), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := os.ReadFile(filepath.Join("testdata", filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+
+		fn(name, b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk testdata: %+v", err)
+	}
+}
+
+// writeZip writes testdata into a zip archive under a top-level directory.
+func writeZip(t *testing.T, name string) {
+	t.Helper()
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("failed to create zip: %+v", err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	walkTestdata(t, func(name string, b []byte) {
+		method := zip.Deflate
+		if strings.HasPrefix(name, "Build/") {
+			method = zip.Store
+		}
+
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     path.Join("WebGL", name),
+			Method:   method,
+			Modified: archiveModTime,
+		})
+		if err != nil {
+			t.Fatalf("failed to create zip entry: %+v", err)
+		}
+		if _, err := w.Write(b); err != nil {
+			t.Fatalf("failed to write zip entry: %+v", err)
+		}
+	})
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %+v", err)
+	}
+}
+
+// writeTar writes testdata into a tar archive.
+func writeTar(t *testing.T, name string) {
+	t.Helper()
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("failed to create tar: %+v", err)
+	}
+	defer f.Close()
+
+	writeTarEntries(t, f)
+}
+
+// writeTarGz writes testdata into a tar.gz archive.
+func writeTarGz(t *testing.T, name string) {
+	t.Helper()
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("failed to create tar.gz: %+v", err)
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	writeTarEntries(t, zw)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close gzip: %+v", err)
+	}
+}
+
+// writeTarEntries writes testdata as tar entries into w.
+func writeTarEntries(t *testing.T, w io.Writer) {
+	t.Helper()
+
+	tw := tar.NewWriter(w)
+	walkTestdata(t, func(name string, b []byte) {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     int64(len(b)),
+			Mode:     0o644,
+			ModTime:  archiveModTime,
+		})
+		if err != nil {
+			t.Fatalf("failed to write tar header: %+v", err)
+		}
+		if _, err := tw.Write(b); err != nil {
+			t.Fatalf("failed to write tar entry: %+v", err)
+		}
+	})
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %+v", err)
+	}
+}
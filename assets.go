@@ -0,0 +1,41 @@
+package unisrv
+
+import "strings"
+
+// AssetKind represents a kind of assets of Unity WebGL builds.
+type AssetKind string
+
+const (
+	// AssetKindData is the data file containing the assets and scenes.
+	AssetKindData AssetKind = "data"
+	// AssetKindWasm is the WebAssembly code.
+	AssetKindWasm AssetKind = "wasm"
+	// AssetKindFramework is the JavaScript runtime and plugin code.
+	AssetKindFramework AssetKind = "framework"
+	// AssetKindSymbols is the debug symbols file.
+	AssetKindSymbols AssetKind = "symbols"
+	// AssetKindOther is any other file such as the loader and `index.html`.
+	AssetKindOther AssetKind = "other"
+)
+
+// AssetKindOf returns the kind of the Unity asset with the name.
+// The compression extension of the name is ignored.
+func AssetKindOf(name string) AssetKind {
+	name = trimCompressionExt(name)
+
+	switch {
+	case strings.HasSuffix(name, ".data"):
+		return AssetKindData
+	case strings.HasSuffix(name, ".wasm"),
+		strings.HasSuffix(name, ".wasm.code"):
+		return AssetKindWasm
+	case strings.HasSuffix(name, ".framework.js"),
+		strings.HasSuffix(name, ".wasm.framework"),
+		strings.HasSuffix(name, ".asm.framework"):
+		return AssetKindFramework
+	case strings.HasSuffix(name, ".symbols.json"):
+		return AssetKindSymbols
+	default:
+		return AssetKindOther
+	}
+}
@@ -0,0 +1,35 @@
+package unisrv_test
+
+import (
+	"testing"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+func TestAssetKindOf(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected unisrv.AssetKind
+	}{
+		{name: "Build/Build.data", expected: unisrv.AssetKindData},
+		{name: "Build/Build.data.br", expected: unisrv.AssetKindData},
+		{name: "Build/Build.data.unityweb", expected: unisrv.AssetKindData},
+		{name: "Build/Build.wasm", expected: unisrv.AssetKindWasm},
+		{name: "Build/Build.wasm.gz", expected: unisrv.AssetKindWasm},
+		{name: "Build/Build.wasm.code.unityweb", expected: unisrv.AssetKindWasm},
+		{name: "Build/Build.framework.js.zst", expected: unisrv.AssetKindFramework},
+		{name: "Build/Build.wasm.framework.unityweb", expected: unisrv.AssetKindFramework},
+		{name: "Build/Build.symbols.json.br", expected: unisrv.AssetKindSymbols},
+		{name: "Build/Build.loader.js", expected: unisrv.AssetKindOther},
+		{name: "index.html", expected: unisrv.AssetKindOther},
+		{name: "", expected: unisrv.AssetKindOther},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			if actual := unisrv.AssetKindOf(v.name); actual != v.expected {
+				tt.Errorf("expected %q, but got %q", v.expected, actual)
+			}
+		})
+	}
+}
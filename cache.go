@@ -0,0 +1,108 @@
+package unisrv
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/frozenbonito/unisrv/internal/pathpattern"
+)
+
+// CacheRule describes a value of `Cache-Control` header for paths matching the pattern.
+//
+// The pattern is matched against the path relative to the base path.
+// It is a glob pattern where `**` matches any number of directories,
+// and a pattern without a slash matches the file name in any directory.
+// Paths of directories are matched as their `index.html`.
+type CacheRule struct {
+	// Pattern specifies the glob pattern of paths, e.g. `Build/*.data.br`.
+	Pattern string
+	// CacheControl specifies the value of `Cache-Control` header, e.g. `max-age=3600`.
+	CacheControl string
+}
+
+const (
+	// CacheControlNoCache is a value of `Cache-Control` header to revalidate responses every time.
+	CacheControlNoCache = "no-cache"
+	// CacheControlImmutable is a value of `Cache-Control` header to cache responses forever.
+	CacheControlImmutable = "max-age=31536000, immutable"
+)
+
+// hashLen is the length of file names of Unity builds with "Name Files As Hashes" option.
+const hashLen = 32
+
+// HashedBuildCacheRules returns cache rules for Unity builds with "Name Files As Hashes" option.
+//
+// Build files named as hashes are cached forever, and the other files such as `index.html` are revalidated every time.
+func HashedBuildCacheRules() []CacheRule {
+	return []CacheRule{
+		{
+			Pattern:      strings.Repeat("[0-9a-f]", hashLen) + ".*",
+			CacheControl: CacheControlImmutable,
+		},
+		{
+			Pattern:      "**",
+			CacheControl: CacheControlNoCache,
+		},
+	}
+}
+
+// ValidateCacheRules reports whether all patterns of the rules are valid.
+func ValidateCacheRules(rules []CacheRule) error {
+	for _, rule := range rules {
+		if _, err := pathpattern.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("cache rule: %w", err)
+		}
+	}
+	return nil
+}
+
+// compiledCacheRule is a CacheRule with the compiled pattern.
+type compiledCacheRule struct {
+	pattern      *pathpattern.Pattern
+	cacheControl string
+}
+
+// cacheControl is a middleware setting `Cache-Control` header by the first rule matching the path.
+// If no rule matches, `no-cache` is set if noCache is true.
+// Rules with invalid patterns are ignored.
+func cacheControl(rules []CacheRule, noCache bool, base string, next http.Handler) http.Handler {
+	compiled := make([]compiledCacheRule, 0, len(rules))
+	for _, rule := range rules {
+		p, err := pathpattern.Compile(rule.Pattern)
+		if err != nil {
+			continue
+		}
+		compiled = append(compiled, compiledCacheRule{
+			pattern:      p,
+			cacheControl: rule.CacheControl,
+		})
+	}
+
+	if len(compiled) == 0 && !noCache {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(base, "/"))
+		if name == "" || strings.HasSuffix(name, "/") {
+			name += "index.html"
+		}
+
+		value := ""
+		if noCache {
+			value = CacheControlNoCache
+		}
+		for _, rule := range compiled {
+			if rule.pattern.Match(name) {
+				value = rule.cacheControl
+				break
+			}
+		}
+
+		if value != "" {
+			w.Header().Set("Cache-Control", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
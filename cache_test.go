@@ -0,0 +1,114 @@
+package unisrv_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+func TestNewHandlerCacheRules(t *testing.T) {
+	const hash = "0123456789abcdef0123456789abcdef"
+
+	fsys := fstest.MapFS{
+		"index.html":               {Data: []byte("<html></html>")},
+		"Build/Build.loader.js":    {Data: []byte("loader")},
+		"Build/" + hash + ".data":  {Data: []byte("data")},
+		"Build/" + hash + ".js.br": {Data: []byte("framework")},
+		"TemplateData/style.css":   {Data: []byte("style")},
+	}
+
+	cases := []struct {
+		name    string
+		opts    *unisrv.Options
+		targets map[string]string
+	}{
+		{
+			name: "no rules",
+			opts: &unisrv.Options{},
+			targets: map[string]string{
+				"/":                        "",
+				"/Build/" + hash + ".data": "",
+			},
+		},
+		{
+			name: "no cache",
+			opts: &unisrv.Options{
+				NoCache: true,
+			},
+			targets: map[string]string{
+				"/":                        "no-cache",
+				"/Build/" + hash + ".data": "no-cache",
+			},
+		},
+		{
+			name: "hashed build preset",
+			opts: &unisrv.Options{
+				CacheRules: unisrv.HashedBuildCacheRules(),
+			},
+			targets: map[string]string{
+				"/":                         "no-cache",
+				"/Build/Build.loader.js":    "no-cache",
+				"/Build/" + hash + ".data":  "max-age=31536000, immutable",
+				"/Build/" + hash + ".js.br": "max-age=31536000, immutable",
+				"/TemplateData/style.css":   "no-cache",
+			},
+		},
+		{
+			name: "custom rules with base and no cache fallback",
+			opts: &unisrv.Options{
+				Base:    "/base/",
+				NoCache: true,
+				CacheRules: []unisrv.CacheRule{
+					{Pattern: "TemplateData/**", CacheControl: "max-age=3600"},
+					{Pattern: "*.js", CacheControl: "max-age=60"},
+					{Pattern: "[", CacheControl: "max-age=1"},
+				},
+			},
+			targets: map[string]string{
+				"/base/":                       "no-cache",
+				"/base/Build/Build.loader.js":  "max-age=60",
+				"/base/TemplateData/style.css": "max-age=3600",
+			},
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			h := unisrv.NewHandlerFS(fsys, v.opts)
+
+			for target, expected := range v.targets {
+				tt.Run(target, func(ttt *testing.T) {
+					r := httptest.NewRequest(http.MethodGet, target, nil)
+					w := httptest.NewRecorder()
+
+					h.ServeHTTP(w, r)
+
+					resp := w.Result()
+					defer resp.Body.Close()
+
+					if resp.StatusCode != http.StatusOK {
+						ttt.Fatalf("expected %d, but got %d", http.StatusOK, resp.StatusCode)
+					}
+					if actual := resp.Header.Get("Cache-Control"); actual != expected {
+						ttt.Errorf("expected %q, but got %q", expected, actual)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestValidateCacheRules(t *testing.T) {
+	if err := unisrv.ValidateCacheRules(unisrv.HashedBuildCacheRules()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err := unisrv.ValidateCacheRules([]unisrv.CacheRule{{Pattern: "Build/[", CacheControl: "no-store"}})
+	expected := `cache rule: invalid pattern "Build/[": syntax error in pattern`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, but got %v", expected, err)
+	}
+}
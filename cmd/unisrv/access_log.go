@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/frozenbonito/unisrv/internal/logfile"
+)
+
+// bytesPerMegabyte is the number of bytes in a megabyte for -access-log-max-size.
+const bytesPerMegabyte = 1 << 20
+
+// openAccessLog opens the writer of access logs.
+// It is stdout unless -access-log is given, in which case the file is reopened on SIGHUP until ctx is done.
+func openAccessLog(ctx context.Context, cfg *config) (w io.Writer, closeFunc func() error, err error) {
+	if cfg.accessLog == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	f, err := logfile.Open(cfg.accessLog, logfile.Options{
+		MaxSize:  int64(cfg.accessLogMaxSize) * bytesPerMegabyte,
+		Interval: cfg.accessLogRotateInterval,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("open access log: %w", err)
+	}
+
+	go reopenOnHangup(ctx, f)
+
+	return f, f.Close, nil
+}
+
+// reopenOnHangup reopens the log file on SIGHUP for external log rotation tools such as logrotate.
+func reopenOnHangup(ctx context.Context, f *logfile.File) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			if err := f.Reopen(); err != nil {
+				fmt.Fprintln(os.Stderr, "warning: failed to reopen access log:", err)
+			}
+		}
+	}
+}
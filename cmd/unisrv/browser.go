@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// browserCommand returns the command to open the URL in the browser.
+// The browser is a command with optional arguments, e.g. `firefox -private-window`.
+// If it is empty, the default browser of the system is used.
+func browserCommand(browser, url string) *exec.Cmd {
+	if args := strings.Fields(browser); len(args) > 0 {
+		return exec.Command(args[0], append(args[1:], url)...) //nolint:gosec
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url)
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		return exec.Command("xdg-open", url)
+	}
+}
+
+// openBrowser opens the URL in the browser without waiting for it to exit.
+func openBrowser(browser, url string) error {
+	cmd := browserCommand(browser, url)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start %s: %w", cmd.Path, err)
+	}
+
+	go cmd.Wait() //nolint:errcheck
+
+	return nil
+}
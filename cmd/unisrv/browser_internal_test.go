@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestBrowserCommand(t *testing.T) {
+	const url = "http://localhost:5000/"
+
+	defaultArgs := map[string][]string{
+		"darwin":  {"open", url},
+		"windows": {"rundll32", "url.dll,FileProtocolHandler", url},
+	}[runtime.GOOS]
+	if defaultArgs == nil {
+		defaultArgs = []string{"xdg-open", url}
+	}
+
+	cases := []struct {
+		name     string
+		browser  string
+		expected []string
+	}{
+		{
+			name:     "default",
+			browser:  "",
+			expected: defaultArgs,
+		},
+		{
+			name:     "command",
+			browser:  "firefox",
+			expected: []string{"firefox", url},
+		},
+		{
+			name:     "command with args",
+			browser:  "chromium  --incognito",
+			expected: []string{"chromium", "--incognito", url},
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			cmd := browserCommand(v.browser, url)
+			if !reflect.DeepEqual(cmd.Args, v.expected) {
+				tt.Errorf("expected %q, but got %q", v.expected, cmd.Args)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// configFileNames are the names of the configuration file looked up in the served directory.
+var configFileNames = []string{"unisrv.json", "unisrv.toml"}
+
+// locateConfigFile returns the configuration file specified by -config flag or UNISRV_CONFIG,
+// or found in the served directory.
+// The returned bool reports whether the file is specified explicitly and thus required.
+func locateConfigFile(args []string) (name string, required bool) {
+	var (
+		cfg          config
+		printVersion bool
+	)
+	fs := newFlagSet(&cfg, &printVersion)
+	fs.SetOutput(io.Discard)
+	if err := setFromEnv(fs, nil); err != nil {
+		return "", false
+	}
+
+	// Errors are reported when the arguments are parsed again.
+	if err := fs.Parse(args); err != nil {
+		return "", false
+	}
+
+	if cfg.config != "" {
+		return cfg.config, true
+	}
+
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	for _, name := range configFileNames {
+		path := filepath.Join(dir, name)
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+			return path, false
+		}
+	}
+
+	return "", false
+}
+
+// applyConfigFile sets flags from the configuration file.
+// Keys of the file are the flag names.
+func applyConfigFile(fs *flag.FlagSet, name string, required bool, sources configSources) error {
+	values, err := loadConfigFile(name)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		f := fs.Lookup(key)
+		if f == nil || key == "config" || key == "print-config" || key == "version" {
+			return fmt.Errorf("%s: unknown key %q", name, key)
+		}
+
+		if err := setConfigValue(f.Value, values[key]); err != nil {
+			return fmt.Errorf("%s: invalid value for key %q: %w", name, key, err)
+		}
+		sources.add(key, name)
+	}
+
+	return nil
+}
+
+// loadConfigFile decodes the JSON or TOML configuration file.
+func loadConfigFile(name string) (map[string]any, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+
+	var values map[string]any
+	switch ext := filepath.Ext(name); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("%s: unsupported format %q: must be .json or .toml", name, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+
+	return values, nil
+}
+
+// setConfigValue sets the value of the configuration file to the flag.
+// Arrays are accepted for repeatable flags.
+func setConfigValue(v flag.Value, value any) error {
+	if list, ok := value.([]any); ok {
+		if _, ok := v.(*listFlag); !ok {
+			return errors.New("must not be an array")
+		}
+		for _, e := range list {
+			if err := setConfigValue(v, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var s string
+	switch value := value.(type) {
+	case string:
+		s = value
+	case bool:
+		s = strconv.FormatBool(value)
+	case json.Number:
+		s = value.String()
+	case int64:
+		s = strconv.FormatInt(value, 10)
+	case float64:
+		s = strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return errors.New("must be a string, number, boolean or array")
+	}
+
+	if err := v.Set(s); err != nil {
+		return fmt.Errorf("set %q: %w", s, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCommandLineArgsConfigFile(t *testing.T) {
+	// Unset environment variables for test.
+	var printVersion bool
+	newFlagSet(&config{}, &printVersion).VisitAll(func(f *flag.Flag) {
+		key := "UNISRV_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	})
+
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir failed: %+v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write failed: %+v", err)
+		}
+		return path
+	}
+
+	buildDir := filepath.Join(dir, "build")
+	writeFile("build/unisrv.toml", `
+port = 8080
+base = "/base1/"
+watch = true
+throttle-latency = "100ms"
+cache-rule = ["*.js=max-age=60", "*.css=max-age=60"]
+cross-origin-isolation = true
+`)
+	jsonFile := writeFile("unisrv.json", `{
+  "host": "0.0.0.0",
+  "read-timeout": 10,
+  "cache-rule": "*.html=no-store",
+  "cors-origins": "*"
+}`)
+	unknownKeyFile := writeFile("unknown.toml", `prot = 8080`)
+	invalidValueFile := writeFile("invalid.json", `{"port": "http"}`)
+	arrayFile := writeFile("array.json", `{"host": ["a", "b"]}`)
+	syntaxErrorFile := writeFile("syntax.toml", `port = `)
+	yamlFile := writeFile("unisrv.yaml", `port: 8080`)
+
+	cases := []struct {
+		name   string
+		env    map[string]string
+		args   []string
+		cfg    *config
+		errMsg string
+	}{
+		{
+			name: "file in served directory",
+			args: []string{buildDir},
+			cfg: &config{
+				dir:                  buildDir,
+				host:                 "localhost",
+				port:                 8080,
+				base:                 "/base1/",
+				readTimeout:          defaultReadTimeout,
+				writeTimeout:         defaultWriteTimeout,
+				accessLogFormat:      "text",
+				shutdownTimeout:      defaultShutdownTimeout,
+				cacheRules:           "*.js=max-age=60;*.css=max-age=60",
+				watch:                true,
+				throttleLatency:      100 * time.Millisecond,
+				crossOriginIsolation: "require-corp",
+			},
+		},
+		{
+			name: "env vars and args take precedence",
+			env: map[string]string{
+				"UNISRV_PORT":       "9000",
+				"UNISRV_CACHE_RULE": "*.wasm=max-age=60",
+			},
+			args: []string{"-base", "/base2/", "-cache-rule", "*.data=max-age=60", buildDir},
+			cfg: &config{
+				dir:                  buildDir,
+				host:                 "localhost",
+				port:                 9000,
+				base:                 "/base2/",
+				readTimeout:          defaultReadTimeout,
+				writeTimeout:         defaultWriteTimeout,
+				accessLogFormat:      "text",
+				shutdownTimeout:      defaultShutdownTimeout,
+				cacheRules:           "*.data=max-age=60;*.wasm=max-age=60;*.js=max-age=60;*.css=max-age=60",
+				watch:                true,
+				throttleLatency:      100 * time.Millisecond,
+				crossOriginIsolation: "require-corp",
+			},
+		},
+		{
+			name: "config flag",
+			args: []string{"-config", jsonFile, buildDir},
+			cfg: &config{
+				config:          jsonFile,
+				dir:             buildDir,
+				host:            "0.0.0.0",
+				port:            defaultPort,
+				readTimeout:     10,
+				writeTimeout:    defaultWriteTimeout,
+				accessLogFormat: "text",
+				shutdownTimeout: defaultShutdownTimeout,
+				cacheRules:      "*.html=no-store",
+				corsOrigins:     "*",
+			},
+		},
+		{
+			name: "config env var",
+			env:  map[string]string{"UNISRV_CONFIG": jsonFile},
+			args: []string{},
+			cfg: &config{
+				config:          jsonFile,
+				host:            "0.0.0.0",
+				port:            defaultPort,
+				readTimeout:     10,
+				writeTimeout:    defaultWriteTimeout,
+				accessLogFormat: "text",
+				shutdownTimeout: defaultShutdownTimeout,
+				cacheRules:      "*.html=no-store",
+				corsOrigins:     "*",
+			},
+		},
+		{
+			name: "no file",
+			args: []string{filepath.Join(dir, "missing")},
+			cfg: &config{
+				dir:             filepath.Join(dir, "missing"),
+				host:            "localhost",
+				port:            defaultPort,
+				readTimeout:     defaultReadTimeout,
+				writeTimeout:    defaultWriteTimeout,
+				accessLogFormat: "text",
+				shutdownTimeout: defaultShutdownTimeout,
+			},
+		},
+		{
+			name:   "missing config file",
+			args:   []string{"-config", filepath.Join(dir, "missing.json")},
+			errMsg: "missing.json",
+		},
+		{
+			name:   "unknown key",
+			args:   []string{"-config", unknownKeyFile},
+			errMsg: `unknown key "prot"`,
+		},
+		{
+			name:   "invalid value",
+			args:   []string{"-config", invalidValueFile},
+			errMsg: `invalid value for key "port"`,
+		},
+		{
+			name:   "array for non-repeatable flag",
+			args:   []string{"-config", arrayFile},
+			errMsg: `invalid value for key "host"`,
+		},
+		{
+			name:   "syntax error",
+			args:   []string{"-config", syntaxErrorFile},
+			errMsg: "parse " + syntaxErrorFile,
+		},
+		{
+			name:   "unsupported format",
+			args:   []string{"-config", yamlFile},
+			errMsg: "unsupported format",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			for key, value := range v.env {
+				tt.Setenv(key, value)
+			}
+
+			cfg, _, err := parseCommandLineArgs(v.args)
+
+			if v.errMsg != "" {
+				if err == nil {
+					tt.Fatalf("unexpected success")
+				}
+				if !strings.Contains(err.Error(), v.errMsg) {
+					tt.Errorf("expected error containing %q, but got %q", v.errMsg, err.Error())
+				}
+				return
+			}
+
+			if err != nil {
+				tt.Fatalf("unexpected error: %+v", err)
+			}
+
+			if !reflect.DeepEqual(cfg, v.cfg) {
+				tt.Errorf("expected %#v, but got %#v", v.cfg, cfg)
+			}
+		})
+	}
+}
+
+func TestParseCommandLineArgsConfigFileListPrecedence(t *testing.T) {
+	// Unset environment variables for test.
+	var printVersion bool
+	newFlagSet(&config{}, &printVersion).VisitAll(func(f *flag.Flag) {
+		t.Setenv(envKey(f.Name), "")
+		os.Unsetenv(envKey(f.Name))
+	})
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "unisrv.toml"), []byte(`
+cache-rule = "*.data=max-age=60"
+throttle-rule = "*.data=slow-3g"
+fault = "*.data=reset"
+`), 0o600)
+	if err != nil {
+		t.Fatalf("write failed: %+v", err)
+	}
+	t.Setenv("UNISRV_CACHE_RULE", "*.data=no-store")
+	t.Setenv("UNISRV_THROTTLE_RULE", "*.data=none")
+	t.Setenv("UNISRV_FAULT", "*.data=503")
+
+	cfg, _, err := parseCommandLineArgs([]string{dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	// Rules are matched in order, so the ones from the environment variables must come first.
+	const name = "Build/Build.data"
+
+	t.Run("cache-rule", func(tt *testing.T) {
+		rules, err := parseCacheRules(cfg.cacheRules)
+		if err != nil {
+			tt.Fatalf("unexpected error: %+v", err)
+		}
+		if expected := "no-store"; rules[0].CacheControl != expected {
+			tt.Errorf("expected %q, but got %q", expected, rules[0].CacheControl)
+		}
+	})
+
+	t.Run("throttle-rule", func(tt *testing.T) {
+		throttle, err := cfg.throttleConfig()
+		if err != nil {
+			tt.Fatalf("unexpected error: %+v", err)
+		}
+		for _, rule := range throttle.Rules {
+			if rule.Pattern.Match(name) {
+				if rule.Profile.Bandwidth != 0 {
+					tt.Errorf("expected no throttling, but got %#v", rule.Profile)
+				}
+				return
+			}
+		}
+		tt.Errorf("no rule matched")
+	})
+
+	t.Run("fault", func(tt *testing.T) {
+		rules, err := cfg.faultRules()
+		if err != nil {
+			tt.Fatalf("unexpected error: %+v", err)
+		}
+		for _, rule := range rules {
+			if rule.Pattern.Match(name) {
+				if rule.Action.Status != http.StatusServiceUnavailable {
+					tt.Errorf("expected %d, but got %d", http.StatusServiceUnavailable, rule.Action.Status)
+				}
+				return
+			}
+		}
+		tt.Errorf("no rule matched")
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	sourceDefault  = "default"
+	sourceFlag     = "flag"
+	sourceArgument = "argument"
+
+	// dirSetting is the name of the setting for the served directory given as the argument.
+	dirSetting = "path"
+
+	printConfigPadding = 2
+)
+
+// configSources records where the values of flags came from.
+// Values of repeatable flags may come from multiple sources.
+type configSources map[string][]string
+
+func (s configSources) add(name, source string) {
+	if s == nil {
+		return
+	}
+	s[name] = append(s[name], source)
+}
+
+func (s configSources) get(name string) string {
+	if len(s[name]) == 0 {
+		return sourceDefault
+	}
+	return strings.Join(s[name], ", ")
+}
+
+// describe returns where the value of the flag came from for error messages,
+// e.g. `environment variable UNISRV_PORT`.
+func (s configSources) describe(name string) string {
+	if len(s[name]) == 0 {
+		return "default value of -" + name
+	}
+
+	descriptions := make([]string, 0, len(s[name]))
+	for _, source := range s[name] {
+		switch {
+		case source == sourceFlag:
+			descriptions = append(descriptions, "flag -"+name)
+		case source == envKey(name):
+			descriptions = append(descriptions, "environment variable "+source)
+		default:
+			descriptions = append(descriptions, fmt.Sprintf("key %q in %s", name, source))
+		}
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// describeSettingError adds the invalid value and where it came from to the error returned by config.validate,
+// e.g. `invalid value "70000" for environment variable UNISRV_PORT: invalid port`.
+func describeSettingError(fs *flag.FlagSet, sources configSources, err error) error {
+	var settingErr *settingError
+	if !errors.As(err, &settingErr) {
+		return err
+	}
+
+	f := fs.Lookup(settingErr.name)
+	if f == nil {
+		return err
+	}
+	return fmt.Errorf("invalid value %q for %s: %w", f.Value.String(), sources.describe(f.Name), err)
+}
+
+// setting is an effective value of the configuration.
+type setting struct {
+	name   string
+	value  string
+	source string
+}
+
+// newSettings returns the effective values of the flags and the served directory with their sources.
+func newSettings(fs *flag.FlagSet, dir string, sources configSources) []setting {
+	if dir == "" {
+		dir = "."
+	}
+	settings := []setting{{name: dirSetting, value: dir, source: sources.get(dirSetting)}}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "version" || f.Name == "print-config" {
+			return
+		}
+		settings = append(settings, setting{name: f.Name, value: f.Value.String(), source: sources.get(f.Name)})
+	})
+
+	return settings
+}
+
+// printConfig prints the effective configuration and where each value came from.
+func printConfig(w io.Writer, cfg *config) error {
+	tw := tabwriter.NewWriter(w, 0, 0, printConfigPadding, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVALUE\tSOURCE")
+	for _, s := range cfg.settings {
+		fmt.Fprintf(tw, "%s\t%q\t%s\n", s.name, s.value, s.source)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("print config: %w", err)
+	}
+
+	return nil
+}
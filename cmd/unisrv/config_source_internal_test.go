@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandLineArgsEnvError(t *testing.T) {
+	// Unset environment variables for test.
+	var printVersion bool
+	newFlagSet(&config{}, &printVersion).VisitAll(func(f *flag.Flag) {
+		t.Setenv(envKey(f.Name), "")
+		os.Unsetenv(envKey(f.Name))
+	})
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "unisrv.toml"), []byte("port = 70000\n"), 0o600); err != nil {
+		t.Fatalf("write failed: %+v", err)
+	}
+
+	cases := []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "unparsable env var",
+			env:      map[string]string{"UNISRV_PORT": "abc"},
+			expected: `invalid value "abc" for environment variable UNISRV_PORT`,
+		},
+		{
+			name:     "out of range env var",
+			env:      map[string]string{"UNISRV_PORT": "70000"},
+			expected: `invalid value "70000" for environment variable UNISRV_PORT: invalid port`,
+		},
+		{
+			name:     "invalid fault env var",
+			env:      map[string]string{"UNISRV_FAULT": "*.data=404"},
+			expected: `invalid value "*.data=404" for environment variable UNISRV_FAULT: fault: invalid fault rule`,
+		},
+		{
+			name:     "invalid throttle env var",
+			env:      map[string]string{"UNISRV_THROTTLE": "5g"},
+			expected: `invalid value "5g" for environment variable UNISRV_THROTTLE: throttle: invalid throttle profile`,
+		},
+		{
+			name:     "invalid cache rule env var",
+			env:      map[string]string{"UNISRV_CACHE_RULE": "Build/*"},
+			expected: `invalid value "Build/*" for environment variable UNISRV_CACHE_RULE: invalid cache rule`,
+		},
+		{
+			name:     "invalid cache rule from multiple sources",
+			env:      map[string]string{"UNISRV_CACHE_RULE": "Build/*"},
+			args:     []string{"-cache-rule", "*.html=no-store"},
+			expected: `invalid value "*.html=no-store;Build/*" for environment variable UNISRV_CACHE_RULE, flag -cache-rule`,
+		},
+		{
+			name:     "invalid flag",
+			args:     []string{"-port", "70000"},
+			expected: `invalid value "70000" for flag -port: invalid port`,
+		},
+		{
+			name:     "invalid config file",
+			args:     []string{dir},
+			expected: `invalid value "70000" for key "port" in ` + filepath.Join(dir, "unisrv.toml") + `: invalid port`,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			for key, value := range v.env {
+				tt.Setenv(key, value)
+			}
+
+			_, _, err := parseCommandLineArgs(append([]string{}, v.args...))
+			if err == nil {
+				tt.Fatalf("unexpected success")
+			}
+			if errors.Is(err, errParseFlags) {
+				tt.Errorf("expected to be reported, but got %q", err.Error())
+			}
+			if !strings.Contains(err.Error(), v.expected) {
+				tt.Errorf("expected error containing %q, but got %q", v.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	// Unset environment variables for test.
+	var printVersion bool
+	newFlagSet(&config{}, &printVersion).VisitAll(func(f *flag.Flag) {
+		t.Setenv(envKey(f.Name), "")
+		os.Unsetenv(envKey(f.Name))
+	})
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "unisrv.toml")
+	if err := os.WriteFile(configFile, []byte("port = 8080\ncache-rule = \"*.js=max-age=60\"\n"), 0o600); err != nil {
+		t.Fatalf("write failed: %+v", err)
+	}
+	t.Setenv("UNISRV_CACHE_RULE", "*.css=max-age=60")
+	t.Setenv("UNISRV_WATCH", "true")
+
+	args := []string{"-print-config", "-host", "0.0.0.0", "-cache-rule", "*.html=no-store", dir}
+	cfg, _, err := parseCommandLineArgs(args)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	var out strings.Builder
+	if err := printConfig(&out, cfg); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	sources := map[string]string{}
+	values := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+		fields := strings.Fields(line)
+		values[fields[0]] = fields[1]
+		sources[fields[0]] = strings.Join(fields[2:], " ")
+	}
+
+	cases := []struct {
+		name   string
+		value  string
+		source string
+	}{
+		{name: "path", value: strconv.Quote(dir), source: "argument"},
+		{name: "host", value: `"0.0.0.0"`, source: "flag"},
+		{name: "port", value: `"8080"`, source: configFile},
+		{name: "watch", value: `"true"`, source: "UNISRV_WATCH"},
+		{name: "read-timeout", value: `"5"`, source: "default"},
+		{
+			name:   "cache-rule",
+			value:  `"*.html=no-store;*.css=max-age=60;*.js=max-age=60"`,
+			source: configFile + ", UNISRV_CACHE_RULE, flag",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			if actual := values[v.name]; actual != v.value {
+				tt.Errorf("expected value %s, but got %s", v.value, actual)
+			}
+			if actual := sources[v.name]; actual != v.source {
+				tt.Errorf("expected source %q, but got %q", v.source, actual)
+			}
+		})
+	}
+
+	for _, name := range []string{"version", "print-config"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("expected %s not to be printed", name)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+// consoleTimeFormat is the layout of the time the console message was generated in the browser.
+const consoleTimeFormat = "15:04:05.000"
+
+// consoleLogger writes the browser console messages to stderr.
+var consoleLogger = log.New(os.Stderr, "", log.LstdFlags)
+
+// logConsole prints the browser console message forwarded by unisrv handler.
+// The values sent by the browser are escaped so that pages cannot control the terminal.
+func logConsole(msg *unisrv.ConsoleMessage) {
+	consoleLogger.Printf("console [%s %s] %s %s: %s",
+		escapeControl(msg.Client), msg.RemoteAddr, msg.Time.Format(consoleTimeFormat),
+		escapeControl(msg.Level), escapeControl(msg.Text))
+}
+
+// escapeControl escapes control characters except newlines and tabs, e.g. ESC is replaced with `\x1b`.
+func escapeControl(s string) string {
+	if !strings.ContainsFunc(s, isEscapedControl) {
+		return s
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		if isEscapedControl(r) {
+			fmt.Fprintf(&b, `\x%02x`, r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isEscapedControl reports whether r is a control character to be escaped.
+func isEscapedControl(r rune) bool {
+	return unicode.IsControl(r) && r != '\n' && r != '\t'
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+func TestLogConsole(t *testing.T) {
+	cases := []struct {
+		name     string
+		level    string
+		text     string
+		expected string
+	}{
+		{
+			name:     "text",
+			level:    "warn",
+			text:     "hello",
+			expected: "console [abc123 192.0.2.1:1234] 03:04:05.006 warn: hello\n",
+		},
+		{
+			name:     "multiline text",
+			level:    "error",
+			text:     "error\n\tat foo",
+			expected: "console [abc123 192.0.2.1:1234] 03:04:05.006 error: error\n\tat foo\n",
+		},
+		{
+			name:     "control characters",
+			level:    "log\x1b[2J",
+			text:     "\x1b]0;x\x07\x1b[31mred\r\u009b",
+			expected: "console [abc123 192.0.2.1:1234] 03:04:05.006 log\\x1b[2J: \\x1b]0;x\\x07\\x1b[31mred\\x0d\\x9b\n",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			var buf bytes.Buffer
+			original := consoleLogger
+			consoleLogger = log.New(&buf, "", 0)
+			defer func() {
+				consoleLogger = original
+			}()
+
+			logConsole(&unisrv.ConsoleMessage{
+				Client:     "abc123",
+				RemoteAddr: "192.0.2.1:1234",
+				Level:      v.level,
+				Time:       time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.Local),
+				Text:       v.text,
+			})
+
+			if actual := buf.String(); actual != v.expected {
+				tt.Errorf("expected %q, but got %q", v.expected, actual)
+			}
+		})
+	}
+}
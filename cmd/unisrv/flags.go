@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+// crossOriginIsolationFlag is a flag.Value for the cross-origin isolation mode.
+// It can also be used as a boolean flag, in which case `true` means `require-corp`.
+type crossOriginIsolationFlag struct {
+	value *string
+}
+
+func (f crossOriginIsolationFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f crossOriginIsolationFlag) Set(s string) error {
+	switch s {
+	case "true":
+		*f.value = string(unisrv.CrossOriginIsolationRequireCorp)
+	case "false", "":
+		*f.value = ""
+	case string(unisrv.CrossOriginIsolationRequireCorp), string(unisrv.CrossOriginIsolationCredentialless):
+		*f.value = s
+	default:
+		return fmt.Errorf("must be one of true, false, %s or %s",
+			unisrv.CrossOriginIsolationRequireCorp, unisrv.CrossOriginIsolationCredentialless)
+	}
+	return nil
+}
+
+func (f crossOriginIsolationFlag) IsBoolFlag() bool {
+	return true
+}
+
+// listFlag is a flag.Value which can be repeated.
+// Each value is joined with the separator.
+//
+// Values are set from the configuration sources in ascending order of precedence.
+// Values set from a source are placed before the ones from the previous sources
+// so that they take precedence in the rules matched in order.
+type listFlag struct {
+	value     *string
+	separator string
+	// lower is the values set from the previous sources.
+	lower string
+	// current is the values set from the current source.
+	current []string
+}
+
+func newListFlag(value *string, separator string) *listFlag {
+	return &listFlag{value: value, separator: separator}
+}
+
+func (f *listFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f *listFlag) Set(s string) error {
+	f.current = append(f.current, s)
+
+	value := strings.Join(f.current, f.separator)
+	if f.lower != "" {
+		value += f.separator + f.lower
+	}
+	*f.value = value
+	return nil
+}
+
+// nextSource makes the values set after it take precedence over the values set so far.
+func (f *listFlag) nextSource() {
+	f.lower = *f.value
+	f.current = nil
+}
+
+// nextListSource calls nextSource of the repeatable flags in fs.
+func nextListSource(fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if l, ok := f.Value.(*listFlag); ok {
+			l.nextSource()
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	healthEndpoint = "__unisrv/healthz"
+
+	defaultHealthcheckTimeout = 5 * time.Second
+	// maxHealthBodySize is the maximum size of the response body of the health endpoint to report.
+	maxHealthBodySize = 1 << 10
+)
+
+// healthHandler returns a handler of the health endpoint.
+// It responds 200 if the served directory is readable, otherwise 503.
+func healthHandler(fsys fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+
+		if _, err := fs.ReadDir(fsys, "."); err != nil {
+			http.Error(w, fmt.Sprintf("unhealthy: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// healthcheckConfig is config of healthcheck command.
+type healthcheckConfig struct {
+	url     string
+	timeout time.Duration
+	// dir is the directory served by the server, where its configuration file is looked up.
+	dir string
+}
+
+// parseHealthcheckArgs parses given arguments of healthcheck command.
+func parseHealthcheckArgs(args []string) (*healthcheckConfig, error) {
+	cfg := &healthcheckConfig{}
+
+	fs := flag.NewFlagSet("unisrv healthcheck", flag.ContinueOnError)
+	fs.StringVar(&cfg.url, "url", "",
+		"URL of the health endpoint (default derived from the configuration of the server serving path)")
+	fs.DurationVar(&cfg.timeout, "timeout", defaultHealthcheckTimeout, "timeout of the health check")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: unisrv healthcheck [flags] [path]\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("parse flags: %w", err)
+	}
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return nil, errors.New("too many arguments")
+	}
+	cfg.dir = fs.Arg(0)
+
+	return cfg, nil
+}
+
+// defaultHealthURL returns the URL of the health endpoint of the server serving dir,
+// configured by the environment variables and the configuration file in dir.
+// An empty dir means the working directory.
+func defaultHealthURL(dir string) (string, error) {
+	var args []string
+	if dir != "" {
+		args = append(args, dir)
+	}
+	cfg, _, err := parseCommandLineArgs(args)
+	if err != nil {
+		return "", err
+	}
+	cfg.normalize()
+
+	return cfg.url(cfg.port) + healthEndpoint, nil
+}
+
+// runHealthcheck probes the health endpoint and returns an error if the server is unhealthy.
+func runHealthcheck(ctx context.Context, cfg *healthcheckConfig) error {
+	url := cfg.url
+	if url == "" {
+		var err error
+		if url, err = defaultHealthURL(cfg.dir); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			// The server is probed locally and may use a certificate signed by the local CA.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxHealthBodySize))
+		return fmt.Errorf("unhealthy: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestHealthHandler(t *testing.T) {
+	cases := []struct {
+		name     string
+		fsys     fstest.MapFS
+		missing  bool
+		method   string
+		expected int
+	}{
+		{
+			name:     "healthy",
+			fsys:     fstest.MapFS{"index.html": {Data: []byte("ok")}},
+			method:   http.MethodGet,
+			expected: http.StatusOK,
+		},
+		{
+			name:     "head",
+			fsys:     fstest.MapFS{"index.html": {Data: []byte("ok")}},
+			method:   http.MethodHead,
+			expected: http.StatusOK,
+		},
+		{
+			name:     "unreadable directory",
+			missing:  true,
+			method:   http.MethodGet,
+			expected: http.StatusServiceUnavailable,
+		},
+		{
+			name:     "method not allowed",
+			fsys:     fstest.MapFS{},
+			method:   http.MethodPost,
+			expected: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			h := healthHandler(v.fsys)
+			if v.missing {
+				h = healthHandler(os.DirFS(filepath.Join(tt.TempDir(), "missing")))
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(v.method, "/"+healthEndpoint, nil))
+
+			if w.Code != v.expected {
+				tt.Errorf("expected %d, but got %d", v.expected, w.Code)
+			}
+			if cacheControl := w.Header().Get("Cache-Control"); v.expected != http.StatusMethodNotAllowed &&
+				cacheControl != "no-store" {
+				tt.Errorf("expected %q, but got %q", "no-store", cacheControl)
+			}
+		})
+	}
+}
+
+func TestNewServerHealth(t *testing.T) {
+	cases := []struct {
+		name string
+		base string
+	}{
+		{name: "root", base: "/"},
+		{name: "base path", base: "/base/"},
+	}
+
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte("index")},
+		"healthz":    {Data: []byte("build file")},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			cfg := &config{
+				host: "localhost",
+				base: v.base,
+			}
+
+			srv := httptest.NewServer(newServer(cfg, fsys, io.Discard, nil).Handler)
+			defer srv.Close()
+
+			get := func(url string) string {
+				resp, err := http.Get(url)
+				if err != nil {
+					tt.Fatalf("request failed: %+v", err)
+				}
+				defer resp.Body.Close()
+
+				b, err := io.ReadAll(resp.Body)
+				if err != nil {
+					tt.Fatalf("read failed: %+v", err)
+				}
+				return string(b)
+			}
+
+			// The health endpoint must not shadow a build file of the same name.
+			if body := get(srv.URL + v.base + "healthz"); body != "build file" {
+				tt.Errorf("expected %q, but got %q", "build file", body)
+			}
+			if body := get(srv.URL + v.base + healthEndpoint); body != "ok\n" {
+				tt.Errorf("expected %q, but got %q", "ok\n", body)
+			}
+		})
+	}
+}
+
+func TestParseHealthcheckArgs(t *testing.T) {
+	cases := []struct {
+		name   string
+		args   []string
+		cfg    *healthcheckConfig
+		failed bool
+	}{
+		{
+			name: "default",
+			args: []string{},
+			cfg: &healthcheckConfig{
+				timeout: defaultHealthcheckTimeout,
+			},
+		},
+		{
+			name: "args",
+			args: []string{"-url", "http://localhost:8080/healthz", "-timeout", "1s"},
+			cfg: &healthcheckConfig{
+				url:     "http://localhost:8080/healthz",
+				timeout: time.Second,
+			},
+		},
+		{
+			name:   "invalid args",
+			args:   []string{"-unknown"},
+			failed: true,
+		},
+		{
+			name: "served directory",
+			args: []string{"-timeout", "1s", "dir"},
+			cfg: &healthcheckConfig{
+				timeout: time.Second,
+				dir:     "dir",
+			},
+		},
+		{
+			name:   "too many args",
+			args:   []string{"dir", "extra"},
+			failed: true,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			cfg, err := parseHealthcheckArgs(v.args)
+
+			switch {
+			case err != nil && !v.failed:
+				tt.Errorf("unexpected error")
+			case err == nil && v.failed:
+				tt.Errorf("unexpected success")
+			default:
+				// nop
+			}
+
+			if v.failed || tt.Failed() {
+				return
+			}
+
+			if !reflect.DeepEqual(cfg, v.cfg) {
+				tt.Errorf("expected %#v, but got %#v", v.cfg, cfg)
+			}
+		})
+	}
+}
+
+func TestRunHealthcheck(t *testing.T) {
+	healthy := httptest.NewServer(healthHandler(fstest.MapFS{"index.html": {Data: []byte("ok")}}))
+	defer healthy.Close()
+
+	unhealthy := httptest.NewServer(healthHandler(os.DirFS(filepath.Join(t.TempDir(), "missing"))))
+	defer unhealthy.Close()
+
+	tlsHealthy := httptest.NewTLSServer(healthHandler(fstest.MapFS{}))
+	defer tlsHealthy.Close()
+
+	// Reserve a port which no server listens on.
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen failed: %+v", err)
+	}
+	closedURL := "http://" + listener.Addr().String() + "/" + healthEndpoint
+	listener.Close()
+
+	cases := []struct {
+		name   string
+		url    string
+		failed bool
+	}{
+		{name: "healthy", url: healthy.URL + "/" + healthEndpoint},
+		{name: "healthy over TLS", url: tlsHealthy.URL + "/" + healthEndpoint},
+		{name: "unhealthy", url: unhealthy.URL + "/" + healthEndpoint, failed: true},
+		{name: "not running", url: closedURL, failed: true},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			err := runHealthcheck(context.Background(), &healthcheckConfig{url: v.url, timeout: 5 * time.Second})
+
+			switch {
+			case err != nil && !v.failed:
+				tt.Errorf("unexpected error: %+v", err)
+			case err == nil && v.failed:
+				tt.Errorf("unexpected success")
+			default:
+				// nop
+			}
+		})
+	}
+}
+
+func TestRunHealthcheckDefaultURL(t *testing.T) {
+	cfg := &config{
+		dir:  "testdata",
+		host: "localhost",
+		base: "/base/",
+	}
+
+	srv := newServer(cfg, os.DirFS(cfg.dir), io.Discard, nil)
+	defer srv.Close()
+
+	listener, err := net.Listen("tcp", cfg.addr())
+	if err != nil {
+		t.Fatalf("listen failed: %+v", err)
+	}
+	defer listener.Close()
+
+	go srv.Serve(listener) //nolint:errcheck
+
+	// The URL is derived from the environment variables configuring the server.
+	t.Setenv("UNISRV_HOST", "0.0.0.0")
+	t.Setenv("UNISRV_PORT", strconv.Itoa(listener.Addr().(*net.TCPAddr).Port))
+	t.Setenv("UNISRV_BASE", "/base/")
+
+	url, err := defaultHealthURL("")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if expected := "http://localhost:" + os.Getenv("UNISRV_PORT") + "/base/" + healthEndpoint; url != expected {
+		t.Errorf("expected %q, but got %q", expected, url)
+	}
+
+	if err := runHealthcheck(context.Background(), &healthcheckConfig{timeout: 5 * time.Second}); err != nil {
+		t.Errorf("unexpected error: %+v", err)
+	}
+}
+
+func TestRunHealthcheckServedDir(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+
+	cases := []struct {
+		name string
+		tls  bool
+	}{
+		{name: "http"},
+		{name: "https", tls: true},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			listener, err := net.Listen("tcp", "localhost:0")
+			if err != nil {
+				tt.Fatalf("listen failed: %+v", err)
+			}
+			defer listener.Close()
+
+			// The server is configured only by the configuration file in the served directory.
+			dir := tt.TempDir()
+			config := fmt.Sprintf(`{"port": %d, "base": "/base/", "tls": %v}`,
+				listener.Addr().(*net.TCPAddr).Port, v.tls)
+			for name, data := range map[string]string{"index.html": "ok", "unisrv.json": config} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+					tt.Fatalf("failed to write file: %+v", err)
+				}
+			}
+
+			cfg, _, err := parseCommandLineArgs([]string{dir})
+			if err != nil {
+				tt.Fatalf("unexpected error: %+v", err)
+			}
+			cfg.normalize()
+
+			srv := newServer(cfg, os.DirFS(cfg.dir), io.Discard, nil)
+			defer srv.Close()
+
+			if cfg.useTLS() {
+				if srv.TLSConfig, err = newTLSConfig(cfg); err != nil {
+					tt.Fatalf("tls config failed: %+v", err)
+				}
+				go srv.ServeTLS(listener, "", "") //nolint:errcheck
+			} else {
+				go srv.Serve(listener) //nolint:errcheck
+			}
+
+			err = runHealthcheck(context.Background(), &healthcheckConfig{timeout: 5 * time.Second, dir: dir})
+			if err != nil {
+				tt.Errorf("unexpected error: %+v", err)
+			}
+		})
+	}
+}
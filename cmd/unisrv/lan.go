@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// isUnspecified reports whether the host listens on all interfaces.
+func isUnspecified(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// lanAddrs returns IP addresses of the machine reachable from LAN.
+func lanAddrs() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	var ips []net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		ips = append(ips, ipNet.IP)
+	}
+	return ips
+}
+
+// lanURLs returns URLs of Unity application on LAN addresses if the listener address is on all interfaces.
+// IPv6 addresses are included unless the listener is IPv4 only,
+// since listening on 0.0.0.0 accepts IPv6 connections as well where dual-stack sockets are supported.
+func (s *config) lanURLs(addr *net.TCPAddr) []string {
+	if !addr.IP.IsUnspecified() {
+		return nil
+	}
+
+	ipv4Only := addr.IP.To4() != nil
+
+	var urls []string
+	for _, ip := range lanAddrs() {
+		if ipv4Only && ip.To4() == nil {
+			continue
+		}
+		urls = append(urls, s.urlWithHost(ip.String(), addr.Port))
+	}
+	return urls
+}
+
+// printQRCode prints the QR code of the URL for terminals.
+func printQRCode(w io.Writer, url string) error {
+	qr, err := qrcode.New(url, qrcode.Low)
+	if err != nil {
+		return fmt.Errorf("encode QR code: %w", err)
+	}
+
+	if _, err := io.WriteString(w, qr.ToSmallString(false)); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestConfigLANURLs(t *testing.T) {
+	cases := []struct {
+		name     string
+		addr     *net.TCPAddr
+		none     bool
+		ipv4Only bool
+	}{
+		{
+			name: "specified host",
+			addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+			none: true,
+		},
+		{
+			name:     "IPv4 only",
+			addr:     &net.TCPAddr{IP: net.IPv4zero, Port: 5000},
+			ipv4Only: true,
+		},
+		{
+			name: "dual-stack",
+			addr: &net.TCPAddr{IP: net.IPv6unspecified, Port: 5000},
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			cfg := &config{host: "0.0.0.0", base: "/base/", tls: true}
+
+			var expected []string
+			for _, ip := range lanAddrs() {
+				if v.none || (v.ipv4Only && ip.To4() == nil) {
+					continue
+				}
+				expected = append(expected, "https://"+net.JoinHostPort(ip.String(), "5000")+"/base/")
+			}
+
+			urls := cfg.lanURLs(v.addr)
+			if strings.Join(urls, " ") != strings.Join(expected, " ") {
+				tt.Errorf("expected %q, but got %q", expected, urls)
+			}
+		})
+	}
+}
+
+func TestPrintQRCode(t *testing.T) {
+	var buf strings.Builder
+	if err := printQRCode(&buf, "http://192.168.0.10:5000/"); err != nil {
+		t.Fatalf("print failed: %+v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) < 10 {
+		t.Errorf("expected QR code, but got %q", buf.String())
+	}
+}
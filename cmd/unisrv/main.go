@@ -5,48 +5,158 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/frozenbonito/unisrv"
+	"github.com/frozenbonito/unisrv/internal/localca"
 	"github.com/frozenbonito/unisrv/internal/middleware"
+	"github.com/frozenbonito/unisrv/internal/pathpattern"
 )
 
 const (
 	defaultPort         = 5000
 	defaultReadTimeout  = 5
 	defaultWriteTimeout = 5
+
+	watchInterval = 500 * time.Millisecond
+	watchSettle   = time.Second
+
+	faultsEndpoint  = "__unisrv/faults"
+	metricsEndpoint = "__unisrv/metrics"
+	// metricsAddrPath is the path of the metrics on the separate listener.
+	metricsAddrPath = "/metrics"
 )
 
 var version = "dev"
 
+// errParseFlags is returned when the command line flags are invalid.
+// The flag package has already reported the details.
+var errParseFlags = errors.New("parse flags")
+
 // config is cli config.
 type config struct {
-	dir            string
-	host           string
-	port           int
-	base           string
-	readTimeout    int
-	writeTimeout   int
-	disableNoCache bool
+	config                  string
+	printConfig             bool
+	settings                []setting
+	dir                     string
+	host                    string
+	port                    int
+	base                    string
+	readTimeout             int
+	writeTimeout            int
+	shutdownTimeout         time.Duration
+	accessLog               string
+	accessLogFormat         string
+	accessLogMaxSize        int
+	accessLogRotateInterval time.Duration
+	disableNoCache          bool
+	cacheRules              string
+	cachePreset             string
+	disableETag             bool
+	watch                   bool
+	forwardConsole          bool
+	throttle                string
+	throttleLatency         time.Duration
+	throttleRules           string
+	faults                  string
+	metrics                 bool
+	metricsAddr             string
+	qr                      bool
+	open                    bool
+	browser                 string
+	tls                     bool
+	tlsCert                 string
+	tlsKey                  string
+	crossOriginIsolation    string
+	corsOrigins             string
+	corsMethods             string
+	corsHeaders             string
+	corsCredentials         bool
 }
 
 // validate reports whether the config is valid.
+// The error wraps settingError with the name of the invalid setting.
 func (s *config) validate() error {
 	if s.host == "" {
-		return errors.New("host is required")
+		return invalidSetting("host", errors.New("host is required"))
 	}
 	if s.port < 0 || s.port > 65535 {
-		return errors.New("invalid port")
+		return invalidSetting("port", errors.New("invalid port"))
+	}
+	if s.tlsCert == "" && s.tlsKey != "" {
+		return invalidSetting("tls-key", errors.New("tls-cert and tls-key must be specified together"))
+	}
+	if s.tlsCert != "" && s.tlsKey == "" {
+		return invalidSetting("tls-cert", errors.New("tls-cert and tls-key must be specified together"))
+	}
+	if _, err := parseCacheRules(s.cacheRules); err != nil {
+		return invalidSetting("cache-rule", err)
+	}
+	if _, ok := cachePresets[s.cachePreset]; !ok && s.cachePreset != "" {
+		return invalidSetting("cache-preset", errors.New("invalid cache preset"))
+	}
+	if s.throttle != "" {
+		if _, err := middleware.ParseThrottleProfile(s.throttle); err != nil {
+			return invalidSetting("throttle", fmt.Errorf("throttle: %w", err))
+		}
+	}
+	if _, err := s.throttleConfig(); err != nil {
+		return invalidSetting("throttle-rule", err)
+	}
+	if _, err := s.faultRules(); err != nil {
+		return invalidSetting("fault", err)
+	}
+	if _, err := middleware.ParseAccessLogFormat(s.accessLogFormat); err != nil {
+		return invalidSetting("access-log-format", fmt.Errorf("access log: %w", err))
+	}
+	if s.metricsAddr != "" {
+		if _, _, err := net.SplitHostPort(s.metricsAddr); err != nil {
+			return invalidSetting("metrics-addr", fmt.Errorf("invalid metrics address: %w", err))
+		}
+	}
+	if s.shutdownTimeout < 0 {
+		return invalidSetting("shutdown-timeout", errors.New("shutdown timeout must not be negative"))
+	}
+	if s.accessLogMaxSize < 0 {
+		return invalidSetting("access-log-max-size",
+			errors.New("access log: rotation size and interval must not be negative"))
+	}
+	if s.accessLogRotateInterval < 0 {
+		return invalidSetting("access-log-rotate-interval",
+			errors.New("access log: rotation size and interval must not be negative"))
 	}
 	return nil
 }
 
+// settingError is an error of the invalid value of the setting.
+type settingError struct {
+	// name is the name of the flag.
+	name string
+	err  error
+}
+
+func invalidSetting(name string, err error) error {
+	return &settingError{name: name, err: err}
+}
+
+func (e *settingError) Error() string {
+	return e.err.Error()
+}
+
+func (e *settingError) Unwrap() error {
+	return e.err
+}
+
 // normalize normalizes the config.
 func (s *config) normalize() {
 	if s.dir == "" {
@@ -67,25 +177,205 @@ func (s *config) normalize() {
 
 // addr returns a TCP network address for a server.
 func (s *config) addr() string {
-	return fmt.Sprintf("%s:%d", s.host, s.port)
+	return net.JoinHostPort(s.host, strconv.Itoa(s.port))
+}
+
+// useTLS reports whether the server serves over HTTPS.
+func (s *config) useTLS() bool {
+	return s.tls || s.tlsCert != ""
+}
+
+// openBrowser reports whether to open the URL in the browser on startup.
+func (s *config) openBrowser() bool {
+	return s.open || s.browser != ""
 }
 
 // url returns a URL of Unity application.
+// If the server listens on all interfaces, the URL on localhost is returned.
 func (s *config) url(port int) string {
-	return fmt.Sprintf("http://%s:%d%s", s.host, port, s.base)
+	host := s.host
+	if isUnspecified(host) {
+		host = "localhost"
+	}
+	return s.urlWithHost(host, port)
+}
+
+// urlWithHost returns a URL of Unity application on the host.
+func (s *config) urlWithHost(host string, port int) string {
+	scheme := "http"
+	if s.useTLS() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, strconv.Itoa(port)), s.base)
 }
 
 // serverOptions returns options for unisrv handler.
 func (s *config) serverOptions() *unisrv.Options {
-	return &unisrv.Options{
-		Base:    s.base,
-		NoCache: !s.disableNoCache,
+	opts := &unisrv.Options{
+		Base:                 s.base,
+		NoCache:              !s.disableNoCache,
+		ETag:                 !s.disableETag,
+		CrossOriginIsolation: unisrv.CrossOriginIsolation(s.crossOriginIsolation),
 	}
+
+	// The config has been validated.
+	opts.CacheRules, _ = parseCacheRules(s.cacheRules)
+	if preset, ok := cachePresets[s.cachePreset]; ok {
+		opts.CacheRules = append(opts.CacheRules, preset()...)
+	}
+
+	if s.corsOrigins != "" {
+		opts.CORS = &unisrv.CORSOptions{
+			AllowedOrigins:   splitList(s.corsOrigins),
+			AllowedMethods:   splitList(s.corsMethods),
+			AllowedHeaders:   splitList(s.corsHeaders),
+			AllowCredentials: s.corsCredentials,
+		}
+	}
+
+	return opts
+}
+
+// throttleConfig returns config of the throttling middleware.
+// It returns nil if throttling is disabled.
+func (s *config) throttleConfig() (*middleware.ThrottleConfig, error) {
+	if s.throttle == "" && s.throttleLatency == 0 && s.throttleRules == "" {
+		return nil, nil
+	}
+
+	cfg := &middleware.ThrottleConfig{
+		Base: s.base,
+	}
+
+	if s.throttle != "" {
+		p, err := middleware.ParseThrottleProfile(s.throttle)
+		if err != nil {
+			return nil, fmt.Errorf("throttle: %w", err)
+		}
+		cfg.Default = p
+	}
+	if s.throttleLatency > 0 {
+		cfg.Default.Latency = s.throttleLatency
+	}
+
+	for _, v := range strings.Split(s.throttleRules, ";") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		pattern, profile, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid throttle rule %q: must be PATTERN=PROFILE", v)
+		}
+		compiled, err := pathpattern.Compile(strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid throttle rule: %w", err)
+		}
+		p, err := middleware.ParseThrottleProfile(strings.TrimSpace(profile))
+		if err != nil {
+			return nil, fmt.Errorf("invalid throttle rule: %w", err)
+		}
+		cfg.Rules = append(cfg.Rules, middleware.ThrottleRule{Pattern: compiled, Profile: p})
+	}
+
+	return cfg, nil
+}
+
+// faultRules returns the fault rules.
+func (s *config) faultRules() ([]middleware.FaultRule, error) {
+	var rules []middleware.FaultRule
+	for _, v := range strings.Split(s.faults, ";") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		rule, err := middleware.ParseFaultRule(v)
+		if err != nil {
+			return nil, fmt.Errorf("fault: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// metricsEnabled reports whether to expose the metrics.
+func (s *config) metricsEnabled() bool {
+	return s.metrics || s.metricsAddr != ""
+}
+
+// faultsPath returns the path of the endpoint to toggle fault injection.
+func (s *config) faultsPath() string {
+	return s.base + faultsEndpoint
+}
+
+// metricsPath returns the path of the metrics on the server of the build.
+func (s *config) metricsPath() string {
+	return s.base + metricsEndpoint
+}
+
+// healthPath returns the path of the health endpoint.
+func (s *config) healthPath() string {
+	return s.base + healthEndpoint
+}
+
+// splitList splits the comma separated list.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// cachePresets is the map of cache rule presets by name.
+var cachePresets = map[string]func() []unisrv.CacheRule{
+	"hashed": unisrv.HashedBuildCacheRules,
+}
+
+// parseCacheRules parses the semicolon separated list of cache rules in the form of `PATTERN=VALUE`.
+func parseCacheRules(s string) ([]unisrv.CacheRule, error) {
+	var rules []unisrv.CacheRule
+	for _, v := range strings.Split(s, ";") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		pattern, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid cache rule %q: must be PATTERN=VALUE", v)
+		}
+		rules = append(rules, unisrv.CacheRule{
+			Pattern:      strings.TrimSpace(pattern),
+			CacheControl: strings.TrimSpace(value),
+		})
+	}
+
+	if err := unisrv.ValidateCacheRules(rules); err != nil {
+		return nil, fmt.Errorf("invalid cache rules: %w", err)
+	}
+
+	return rules, nil
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "symbolicate":
+			mainSymbolicate(os.Args[2:])
+			return
+		case "healthcheck":
+			mainHealthcheck(os.Args[2:])
+			return
+		}
+	}
+
 	cfg, printVersion, err := parseCommandLineArgs(os.Args[1:])
 	if err != nil {
+		if !errors.Is(err, errParseFlags) {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
 		os.Exit(2) //nolint:mnd
 	}
 
@@ -94,6 +384,14 @@ func main() {
 		os.Exit(0)
 	}
 
+	if cfg.printConfig {
+		if err := printConfig(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	ctx := context.Background()
 
 	if err := run(ctx, cfg); err != nil {
@@ -102,39 +400,67 @@ func main() {
 	}
 }
 
+// mainSymbolicate runs symbolicate command.
+func mainSymbolicate(args []string) {
+	cfg, err := parseSymbolicateArgs(args)
+	if err != nil {
+		os.Exit(2) //nolint:mnd
+	}
+
+	if err := runSymbolicate(cfg, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// mainHealthcheck runs healthcheck command.
+func mainHealthcheck(args []string) {
+	cfg, err := parseHealthcheckArgs(args)
+	if err != nil {
+		os.Exit(2) //nolint:mnd
+	}
+
+	if err := runHealthcheck(context.Background(), cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
 // parseCommandLineArgs parses given arguments and then returns config and whether the version should be printed.
 func parseCommandLineArgs(args []string) (cfg *config, printVersion bool, err error) {
 	cfg = &config{}
 
-	fs := flag.NewFlagSet("unisrv", flag.ContinueOnError)
+	fs := newFlagSet(cfg, &printVersion)
 
-	fs.StringVar(&cfg.host, "host", "localhost", "hostname")
-	fs.IntVar(&cfg.port, "port", defaultPort, "port number")
-	fs.StringVar(&cfg.base, "base", "", "base path")
-	fs.IntVar(&cfg.readTimeout, "read-timeout", defaultReadTimeout, "maximum duration for reading request in seconds")
-	fs.IntVar(&cfg.writeTimeout, "write-timeout", defaultWriteTimeout, "maximum duration for writing response in seconds")
-	fs.BoolVar(&cfg.disableNoCache, "disable-no-cache", false, "disable setting 'Cache-Control: no-cache' header")
-	fs.BoolVar(&printVersion, "version", false, "print version")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: unisrv [flags] [path]\n"+
+			"       unisrv symbolicate [flags] [file ...]\n"+
+			"       unisrv healthcheck [flags] [path]\n")
+		fs.PrintDefaults()
+	}
 
-	fs.VisitAll(func(f *flag.Flag) {
-		if f.Name == "version" {
-			return
-		}
+	sources := configSources{}
 
-		key := fmt.Sprintf("UNISRV_%s", strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_")))
-		if s := os.Getenv(key); s != "" {
-			f.Value.Set(s) //nolint:errcheck
+	// The configuration file has the lowest precedence, so it is applied first.
+	if name, required := locateConfigFile(args); name != "" {
+		if err := applyConfigFile(fs, name, required, sources); err != nil {
+			return nil, false, fmt.Errorf("load config file: %w", err)
 		}
-	})
+	}
 
-	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "usage: unisrv [flags] [path]\n")
-		fs.PrintDefaults()
+	nextListSource(fs)
+
+	if err := setFromEnv(fs, sources); err != nil {
+		return nil, false, err
 	}
+	nextListSource(fs)
 
 	if err := fs.Parse(args); err != nil {
-		return nil, false, fmt.Errorf("parse flags: %w", err)
+		return nil, false, fmt.Errorf("%w: %w", errParseFlags, err)
 	}
+	fs.Visit(func(f *flag.Flag) {
+		sources.add(f.Name, sourceFlag)
+	})
 
 	nonFlagArgs := fs.Args()
 	if len(nonFlagArgs) > 1 {
@@ -144,12 +470,115 @@ func parseCommandLineArgs(args []string) (cfg *config, printVersion bool, err er
 
 	if len(nonFlagArgs) == 1 {
 		cfg.dir = nonFlagArgs[0]
+		sources.add(dirSetting, sourceArgument)
+	}
+
+	if !printVersion {
+		if err := cfg.validate(); err != nil {
+			return nil, false, describeSettingError(fs, sources, err)
+		}
+	}
+
+	if cfg.printConfig {
+		cfg.settings = newSettings(fs, cfg.dir, sources)
 	}
 
 	return cfg, printVersion, nil
 }
 
+// newFlagSet returns a flag set to parse command line arguments into cfg.
+func newFlagSet(cfg *config, printVersion *bool) *flag.FlagSet {
+	fs := flag.NewFlagSet("unisrv", flag.ContinueOnError)
+
+	fs.StringVar(&cfg.config, "config", "",
+		"configuration file (default unisrv.json or unisrv.toml in the served directory)")
+
+	fs.StringVar(&cfg.host, "host", "localhost", "hostname")
+	fs.IntVar(&cfg.port, "port", defaultPort, "port number")
+	fs.StringVar(&cfg.base, "base", "", "base path")
+	fs.IntVar(&cfg.readTimeout, "read-timeout", defaultReadTimeout, "maximum duration for reading request in seconds")
+	fs.IntVar(&cfg.writeTimeout, "write-timeout", defaultWriteTimeout, "maximum duration for writing response in seconds")
+	fs.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", defaultShutdownTimeout,
+		"maximum duration to wait for connections to be drained on shutdown (0 means no limit)")
+	fs.StringVar(&cfg.accessLog, "access-log", "", "file to write access logs to instead of stdout (reopened on SIGHUP)")
+	fs.StringVar(&cfg.accessLogFormat, "access-log-format", "text",
+		"format of access logs: text, json, common, combined or a template like '{{.Method}} {{.URI}} {{.Status}}'")
+	fs.IntVar(&cfg.accessLogMaxSize, "access-log-max-size", 0, "size in megabytes to rotate the access log file at")
+	fs.DurationVar(&cfg.accessLogRotateInterval, "access-log-rotate-interval", 0,
+		"interval to rotate the access log file at, e.g. 24h")
+	fs.BoolVar(&cfg.disableNoCache, "disable-no-cache", false, "disable setting 'Cache-Control: no-cache' header")
+	fs.Var(newListFlag(&cfg.cacheRules, ";"), "cache-rule",
+		"cache rule in the form of 'PATTERN=CACHE-CONTROL' (semicolon separated and repeatable)")
+	fs.StringVar(&cfg.cachePreset, "cache-preset", "", "cache rule preset applied after -cache-rule: hashed")
+	fs.BoolVar(&cfg.disableETag, "disable-etag", false, "disable setting ETag header computed from file content")
+	fs.BoolVar(&cfg.watch, "watch", false, "reload browsers when the build is updated")
+	fs.BoolVar(&cfg.forwardConsole, "forward-console", false,
+		"print browser console output forwarded by an injected script")
+	fs.StringVar(&cfg.throttle, "throttle", "",
+		"simulate slow network with a preset (slow-3g, 3g, 4g) or bandwidth in kbps, e.g. 500kbps")
+	fs.DurationVar(&cfg.throttleLatency, "throttle-latency", 0, "latency of throttled responses overriding the preset")
+	fs.Var(newListFlag(&cfg.throttleRules, ";"), "throttle-rule",
+		"throttle rule in the form of 'PATTERN=PROFILE' (semicolon separated and repeatable)")
+	fs.BoolVar(&cfg.metrics, "metrics", false, "expose Prometheus metrics at "+metricsEndpoint+" under the base path")
+	fs.StringVar(&cfg.metricsAddr, "metrics-addr", "",
+		"address of a separate listener for the metrics, e.g. :9100 (implies -metrics)")
+	fs.BoolVar(&cfg.qr, "qr", false, "print the QR code of the URL on startup")
+	fs.BoolVar(&cfg.open, "open", false, "open the URL in the browser on startup")
+	fs.StringVar(&cfg.browser, "browser", "",
+		"browser command to open the URL with instead of the system default (implies -open)")
+	fs.BoolVar(&cfg.tls, "tls", false,
+		"serve over HTTPS with a certificate signed by a local CA unless -tls-cert is given")
+	fs.StringVar(&cfg.tlsCert, "tls-cert", "", "TLS certificate file (implies -tls)")
+	fs.StringVar(&cfg.tlsKey, "tls-key", "", "TLS private key file")
+	fs.Var(newListFlag(&cfg.faults, ";"), "fault",
+		"fault rule in the form of 'PATTERN=ACTION[@PROBABILITY]' (semicolon separated and repeatable)")
+	fs.Var(crossOriginIsolationFlag{&cfg.crossOriginIsolation}, "cross-origin-isolation",
+		"enable cross-origin isolation with 'require-corp' (true) or 'credentialless' embedder policy")
+	fs.StringVar(&cfg.corsOrigins, "cors-origins", "", "comma separated origins allowed by CORS ('*' allows any origin)")
+	fs.StringVar(&cfg.corsMethods, "cors-methods", "",
+		"comma separated methods allowed by CORS in addition to GET, HEAD and POST")
+	fs.StringVar(&cfg.corsHeaders, "cors-headers", "", "comma separated request headers allowed by CORS (default any)")
+	fs.BoolVar(&cfg.corsCredentials, "cors-credentials", false, "allow CORS requests with credentials")
+	fs.BoolVar(&cfg.printConfig, "print-config", false, "print the effective configuration and its sources")
+	fs.BoolVar(printVersion, "version", false, "print version")
+
+	return fs
+}
+
+// setFromEnv sets flags from UNISRV_* environment variables.
+// It returns the error of the first variable with an invalid value.
+func setFromEnv(fs *flag.FlagSet, sources configSources) error {
+	var err error
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "version" || f.Name == "print-config" {
+			return
+		}
+
+		key := envKey(f.Name)
+		s := os.Getenv(key)
+		if s == "" {
+			return
+		}
+
+		if setErr := f.Value.Set(s); setErr != nil {
+			err = fmt.Errorf("invalid value %q for environment variable %s: %w", s, key, setErr)
+			return
+		}
+		sources.add(f.Name, key)
+	})
+
+	return err
+}
+
+// envKey returns the environment variable name for the flag.
+func envKey(name string) string {
+	return "UNISRV_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
 // run starts server.
+// Messages other than access logs are written to stderr,
+// so that stdout only has access logs by default and can be piped to log tools.
 func run(ctx context.Context, cfg *config) error {
 	if err := cfg.validate(); err != nil {
 		return fmt.Errorf("validate config: %w", err)
@@ -157,10 +586,47 @@ func run(ctx context.Context, cfg *config) error {
 
 	cfg.normalize()
 
-	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt, os.Kill)
-	defer stop()
+	// Signals are subscribed for the whole run so that a second one during shutdown is not lost.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fsys, closeFS, err := openFS(cfg.dir)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", cfg.dir, err)
+	}
+	defer closeFS() //nolint:errcheck
+
+	if cfg.crossOriginIsolation == "" {
+		if threaded, err := unisrv.IsMultithreaded(fsys); err == nil && threaded {
+			fmt.Fprintln(os.Stderr, "warning: the build looks multithreaded but cross-origin isolation is disabled;",
+				"enable it with -cross-origin-isolation")
+		}
+	}
+
+	accessLog, closeAccessLog, err := openAccessLog(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeAccessLog() //nolint:errcheck
+
+	var metrics *middleware.Metrics
+	if cfg.metricsEnabled() {
+		metrics = middleware.NewMetrics()
+	}
 
-	srv := newServer(cfg)
+	srv := newServer(cfg, fsys, accessLog, metrics)
+	conns := newConnTracker()
+	conns.attach(srv)
+	if cfg.useTLS() {
+		srv.TLSConfig, err = newTLSConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+	}
 
 	listener, err := net.Listen("tcp", cfg.addr())
 	if err != nil {
@@ -170,11 +636,77 @@ func run(ctx context.Context, cfg *config) error {
 
 	port := listener.Addr().(*net.TCPAddr).Port
 
+	var metricsURL string
+	// auxServers are shut down together with the server.
+	var auxServers []*http.Server
+	if cfg.metricsAddr != "" {
+		metricsListener, err := net.Listen("tcp", cfg.metricsAddr)
+		if err != nil {
+			return fmt.Errorf("listen metrics: %w", err)
+		}
+		defer metricsListener.Close()
+
+		metricsSrv := newMetricsServer(cfg, metrics)
+		defer metricsSrv.Close()
+		auxServers = append(auxServers, metricsSrv)
+		go func() {
+			if err := metricsSrv.Serve(metricsListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Fprintln(os.Stderr, "warning: metrics server stopped:", err)
+			}
+		}()
+		metricsURL = "http://" + metricsListener.Addr().String() + metricsAddrPath
+	} else if metrics != nil {
+		metricsURL = cfg.url(port) + metricsEndpoint
+	}
+
 	errChan := make(chan error)
 
-	fmt.Printf("server running at: %s\n", cfg.url(port))
+	fmt.Fprintf(os.Stderr, "server running at: %s\n", cfg.url(port))
+	lanURLs := cfg.lanURLs(listener.Addr().(*net.TCPAddr))
+	for _, u := range lanURLs {
+		fmt.Fprintf(os.Stderr, "also available at: %s\n", u)
+	}
+	if cfg.qr {
+		u := cfg.url(port)
+		if len(lanURLs) > 0 {
+			u = lanURLs[0]
+		}
+		if err := printQRCode(os.Stderr, u); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: failed to print QR code:", err)
+		}
+	}
+	if cfg.watch {
+		fmt.Fprintf(os.Stderr, "watching for changes in: %s\n", cfg.dir)
+	}
+	if metricsURL != "" {
+		fmt.Fprintf(os.Stderr, "metrics available at: %s\n", metricsURL)
+	}
+	if cfg.accessLog != "" {
+		fmt.Fprintf(os.Stderr, "writing access logs to: %s\n", cfg.accessLog)
+	}
+	if cfg.faults != "" {
+		fmt.Fprintf(os.Stderr, "fault injection enabled, toggle it with: curl -X POST %s%s\n", cfg.url(port), faultsEndpoint)
+	}
+	if cfg.useTLS() && cfg.tlsCert == "" {
+		if dir, err := certDir(); err == nil {
+			fmt.Fprintf(os.Stderr, "local CA certificate: %s (trust it to avoid certificate warnings)\n",
+				filepath.Join(dir, localca.CACertFile))
+		}
+	}
+	if cfg.openBrowser() {
+		// The listener is ready to accept the connection from the browser.
+		if err := openBrowser(cfg.browser, cfg.url(port)); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: failed to open browser:", err)
+		}
+	}
 	go func() {
-		if err := srv.Serve(listener); err != nil {
+		serve := srv.Serve
+		if srv.TLSConfig != nil {
+			serve = func(l net.Listener) error {
+				return srv.ServeTLS(l, "", "")
+			}
+		}
+		if err := serve(listener); err != nil {
 			if errors.Is(err, http.ErrServerClosed) {
 				close(errChan)
 				return
@@ -187,21 +719,113 @@ func run(ctx context.Context, cfg *config) error {
 	case err := <-errChan:
 		return err
 	case <-ctx.Done():
-		if err := srv.Shutdown(context.Background()); err != nil {
-			fmt.Fprintln(os.Stderr, "filed to shutdown server:", err)
-		}
+	case <-sigs:
+	}
+
+	// A second signal forces the server to close.
+	fmt.Fprintln(os.Stderr, "shutting down server, press Ctrl+C again to force")
+	drained, killed, err := shutdown(srv, conns, cfg.shutdownTimeout, sigs, auxServers...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to shut down server:", err)
 	}
+	fmt.Fprintf(os.Stderr, "server stopped: %d connections drained, %d killed\n", drained, killed)
 
 	return <-errChan
 }
 
+// openFS opens the file system to serve.
+// The name may be a directory or a zip, tar or tar.gz archive.
+func openFS(name string) (fsys fs.FS, closeFS func() error, err error) {
+	if unisrv.IsArchive(name) {
+		if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() {
+			archive, err := unisrv.OpenArchive(name)
+			if err != nil {
+				return nil, nil, fmt.Errorf("open archive: %w", err)
+			}
+			return archive, archive.Close, nil
+		}
+	}
+
+	return os.DirFS(name), func() error { return nil }, nil
+}
+
 // newServer creates a new server.
-func newServer(cfg *config) *http.Server {
+// The metrics are collected if metrics is not nil,
+// and are served on the same listener unless the separate listener is configured.
+func newServer(cfg *config, fsys fs.FS, accessLog io.Writer, metrics *middleware.Metrics) *http.Server {
 	mux := http.NewServeMux()
 
-	h := unisrv.NewHandler(cfg.dir, cfg.serverOptions())
-	h = middleware.RequestLogger(h)
+	srv := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  time.Duration(cfg.readTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.writeTimeout) * time.Second,
+	}
+
+	opts := cfg.serverOptions()
+	opts.Symbols = loadServerSymbols(fsys)
+	if cfg.watch {
+		liveReload := unisrv.NewLiveReload()
+		opts.LiveReload = liveReload
+
+		// Reload the symbols so that stack traces are symbolicated against the rebuilt build.
+		if opts.Symbols == nil {
+			opts.Symbols = &unisrv.Symbols{}
+		}
+		symbols := opts.Symbols
+		liveReload.OnReload(func() {
+			symbols.Update(loadServerSymbols(fsys))
+		})
+		liveReload.OnStream(markStream)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go liveReload.Watch(ctx, fsys, watchInterval, watchSettle)
+		srv.RegisterOnShutdown(func() {
+			cancel()
+			liveReload.Close()
+		})
+	}
+
+	if cfg.forwardConsole {
+		opts.ForwardConsole = logConsole
+		if opts.Symbols != nil {
+			symbols := opts.Symbols
+			opts.ForwardConsole = func(msg *unisrv.ConsoleMessage) {
+				msg.Text = symbols.Symbolicate(msg.Text)
+				logConsole(msg)
+			}
+		}
+	}
+
+	// The config has been validated.
+	format, _ := middleware.ParseAccessLogFormat(cfg.accessLogFormat)
+	accessLogger, _ := middleware.NewAccessLogger(accessLog, format)
+
+	h := unisrv.NewHandlerFS(fsys, opts)
+	if throttle, _ := cfg.throttleConfig(); throttle != nil {
+		h = middleware.Throttle(throttle, h)
+	}
+	if rules, _ := cfg.faultRules(); len(rules) > 0 {
+		faults := middleware.NewFaults(cfg.base, rules)
+		h = middleware.InjectFaults(faults, h)
+		mux.Handle(cfg.faultsPath(), middleware.RequestLogger(accessLogger, faults))
+	}
+	if metrics != nil {
+		h = middleware.CollectMetrics(metrics, h)
+		if cfg.metricsAddr == "" {
+			mux.Handle(cfg.metricsPath(), metrics)
+		}
+	}
+	h = middleware.RequestLogger(accessLogger, h)
 	mux.Handle(cfg.base, h)
+	mux.Handle(cfg.healthPath(), healthHandler(fsys))
+
+	return srv
+}
+
+// newMetricsServer returns a server exposing only the metrics for the separate listener.
+func newMetricsServer(cfg *config, metrics *middleware.Metrics) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(metricsAddrPath, metrics)
 
 	return &http.Server{
 		Handler:      mux,
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"archive/zip"
+	"context"
+	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/frozenbonito/unisrv"
+	"github.com/frozenbonito/unisrv/internal/middleware"
 )
 
 func TestConfig(t *testing.T) {
@@ -40,33 +47,117 @@ func TestConfig(t *testing.T) {
 			opts: &unisrv.Options{
 				Base:    "/",
 				NoCache: true,
+				ETag:    true,
 			},
 		},
 		{
 			name: "full",
 			cfg: &config{
-				dir:            "dir",
-				host:           "localhost",
-				port:           8080,
-				base:           "/base/",
-				readTimeout:    10,
-				writeTimeout:   15,
-				disableNoCache: true,
+				dir:                  "dir",
+				host:                 "localhost",
+				port:                 8080,
+				base:                 "/base/",
+				readTimeout:          10,
+				writeTimeout:         15,
+				disableNoCache:       true,
+				cacheRules:           "TemplateData/**=max-age=3600",
+				cachePreset:          "hashed",
+				disableETag:          true,
+				crossOriginIsolation: "credentialless",
+				corsOrigins:          "https://a.example.com, https://b.example.com",
+				corsMethods:          "PUT",
+				corsHeaders:          "X-Foo,X-Bar",
+				corsCredentials:      true,
 			},
 			normalized: &config{
-				dir:            "dir",
-				host:           "localhost",
-				port:           8080,
-				base:           "/base/",
-				readTimeout:    10,
-				writeTimeout:   15,
-				disableNoCache: true,
+				dir:                  "dir",
+				host:                 "localhost",
+				port:                 8080,
+				base:                 "/base/",
+				readTimeout:          10,
+				writeTimeout:         15,
+				disableNoCache:       true,
+				cacheRules:           "TemplateData/**=max-age=3600",
+				cachePreset:          "hashed",
+				disableETag:          true,
+				crossOriginIsolation: "credentialless",
+				corsOrigins:          "https://a.example.com, https://b.example.com",
+				corsMethods:          "PUT",
+				corsHeaders:          "X-Foo,X-Bar",
+				corsCredentials:      true,
 			},
 			addr: "localhost:8080",
 			url:  "http://localhost:8080/base/",
 			opts: &unisrv.Options{
 				Base:    "/base/",
 				NoCache: false,
+				CacheRules: append(
+					[]unisrv.CacheRule{{Pattern: "TemplateData/**", CacheControl: "max-age=3600"}},
+					unisrv.HashedBuildCacheRules()...,
+				),
+				CrossOriginIsolation: unisrv.CrossOriginIsolationCredentialless,
+				CORS: &unisrv.CORSOptions{
+					AllowedOrigins:   []string{"https://a.example.com", "https://b.example.com"},
+					AllowedMethods:   []string{"PUT"},
+					AllowedHeaders:   []string{"X-Foo", "X-Bar"},
+					AllowCredentials: true,
+				},
+			},
+		},
+		{
+			name: "tls",
+			cfg: &config{
+				host: "localhost",
+				tls:  true,
+			},
+			normalized: &config{
+				dir:  ".",
+				host: "localhost",
+				base: "/",
+				tls:  true,
+			},
+			addr: "localhost:0",
+			url:  "https://localhost:50000/",
+			opts: &unisrv.Options{
+				Base:    "/",
+				NoCache: true,
+				ETag:    true,
+			},
+		},
+		{
+			name: "unspecified host",
+			cfg: &config{
+				host: "0.0.0.0",
+			},
+			normalized: &config{
+				dir:  ".",
+				host: "0.0.0.0",
+				base: "/",
+			},
+			addr: "0.0.0.0:0",
+			url:  "http://localhost:50000/",
+			opts: &unisrv.Options{
+				Base:    "/",
+				NoCache: true,
+				ETag:    true,
+			},
+		},
+		{
+			name: "IPv6 host",
+			cfg: &config{
+				host: "::1",
+			},
+			normalized: &config{
+				dir:  ".",
+				host: "::1",
+				base: "/",
+			},
+			addr: "[::1]:0",
+			url:  "http://[::1]:50000/",
+			opts: &unisrv.Options{
+				Base:    "/",
+				NoCache: true,
+				ETag:    true,
 			},
 		},
 		{
@@ -86,6 +177,7 @@ func TestConfig(t *testing.T) {
 			opts: &unisrv.Options{
 				Base:    "/base/",
 				NoCache: true,
+				ETag:    true,
 			},
 		},
 		{
@@ -105,6 +197,7 @@ func TestConfig(t *testing.T) {
 			opts: &unisrv.Options{
 				Base:    "/base/",
 				NoCache: true,
+				ETag:    true,
 			},
 		},
 		{
@@ -124,6 +217,7 @@ func TestConfig(t *testing.T) {
 			opts: &unisrv.Options{
 				Base:    "/base/",
 				NoCache: true,
+				ETag:    true,
 			},
 		},
 		{
@@ -147,6 +241,103 @@ func TestConfig(t *testing.T) {
 			},
 			validateErr: "invalid port",
 		},
+		{
+			name: "cache rule has no value",
+			cfg: &config{
+				host:       "localhost",
+				cacheRules: "Build/*",
+			},
+			validateErr: `invalid cache rule "Build/*": must be PATTERN=VALUE`,
+		},
+		{
+			name: "cache rule has invalid pattern",
+			cfg: &config{
+				host:       "localhost",
+				cacheRules: "Build/[=no-store",
+			},
+			validateErr: `invalid cache rules: cache rule: invalid pattern "Build/[": syntax error in pattern`,
+		},
+		{
+			name: "invalid throttle",
+			cfg: &config{
+				host:     "localhost",
+				throttle: "5g",
+			},
+			validateErr: `throttle: invalid throttle profile "5g": must be a preset or bandwidth in kbps`,
+		},
+		{
+			name: "throttle rule has no profile",
+			cfg: &config{
+				host:          "localhost",
+				throttleRules: "*.data",
+			},
+			validateErr: `invalid throttle rule "*.data": must be PATTERN=PROFILE`,
+		},
+		{
+			name: "throttle rule has invalid profile",
+			cfg: &config{
+				host:          "localhost",
+				throttleRules: "*.data=fast",
+			},
+			validateErr: `invalid throttle rule: invalid throttle profile "fast": must be a preset or bandwidth in kbps`,
+		},
+		{
+			name: "tls cert without key",
+			cfg: &config{
+				host:    "localhost",
+				tlsCert: "cert.pem",
+			},
+			validateErr: "tls-cert and tls-key must be specified together",
+		},
+		{
+			name: "invalid fault rule",
+			cfg: &config{
+				host:   "localhost",
+				faults: "*.data=404",
+			},
+			validateErr: `fault: invalid fault rule: invalid fault action "404": ` +
+				`must be a 5xx status code, stall:DURATION, truncate[:PERCENT%] or reset`,
+		},
+		{
+			name: "invalid cache preset",
+			cfg: &config{
+				host:        "localhost",
+				cachePreset: "unknown",
+			},
+			validateErr: "invalid cache preset",
+		},
+		{
+			name: "invalid access log format",
+			cfg: &config{
+				host:            "localhost",
+				accessLogFormat: "xml",
+			},
+			validateErr: `access log: invalid format "xml": must be text, json, common, combined or a template`,
+		},
+		{
+			name: "negative access log max size",
+			cfg: &config{
+				host:             "localhost",
+				accessLogMaxSize: -1,
+			},
+			validateErr: "access log: rotation size and interval must not be negative",
+		},
+		{
+			name: "invalid metrics address",
+			cfg: &config{
+				host:        "localhost",
+				metricsAddr: "9100",
+			},
+			validateErr: "invalid metrics address: address 9100: missing port in address",
+		},
+		{
+			name: "negative shutdown timeout",
+			cfg: &config{
+				host:            "localhost",
+				shutdownTimeout: -time.Second,
+			},
+			validateErr: "shutdown timeout must not be negative",
+		},
 	}
 
 	for _, v := range cases {
@@ -211,12 +402,41 @@ func TestConfig(t *testing.T) {
 func TestParseCommandLineArgs(t *testing.T) {
 	// Unset environment variables for test.
 	envKeys := []string{
+		"UNISRV_CONFIG",
+		"UNISRV_PRINT_CONFIG",
 		"UNISRV_HOST",
 		"UNISRV_PORT",
 		"UNISRV_BASE",
 		"UNISRV_READ_TIMEOUT",
 		"UNISRV_WRITE_TIMEOUT",
+		"UNISRV_SHUTDOWN_TIMEOUT",
+		"UNISRV_ACCESS_LOG",
+		"UNISRV_ACCESS_LOG_FORMAT",
+		"UNISRV_ACCESS_LOG_MAX_SIZE",
+		"UNISRV_ACCESS_LOG_ROTATE_INTERVAL",
 		"UNISRV_DISABLE_NO_CACHE",
+		"UNISRV_CACHE_RULE",
+		"UNISRV_CACHE_PRESET",
+		"UNISRV_DISABLE_ETAG",
+		"UNISRV_WATCH",
+		"UNISRV_FORWARD_CONSOLE",
+		"UNISRV_THROTTLE",
+		"UNISRV_THROTTLE_LATENCY",
+		"UNISRV_THROTTLE_RULE",
+		"UNISRV_FAULT",
+		"UNISRV_METRICS",
+		"UNISRV_METRICS_ADDR",
+		"UNISRV_QR",
+		"UNISRV_OPEN",
+		"UNISRV_BROWSER",
+		"UNISRV_TLS",
+		"UNISRV_TLS_CERT",
+		"UNISRV_TLS_KEY",
+		"UNISRV_CROSS_ORIGIN_ISOLATION",
+		"UNISRV_CORS_ORIGINS",
+		"UNISRV_CORS_METHODS",
+		"UNISRV_CORS_HEADERS",
+		"UNISRV_CORS_CREDENTIALS",
 	}
 	for _, key := range envKeys {
 		t.Setenv(key, "")
@@ -235,41 +455,124 @@ func TestParseCommandLineArgs(t *testing.T) {
 			name: "default",
 			args: []string{},
 			cfg: &config{
-				host:         "localhost",
-				port:         defaultPort,
-				readTimeout:  defaultReadTimeout,
-				writeTimeout: defaultWriteTimeout,
+				host:            "localhost",
+				port:            defaultPort,
+				readTimeout:     defaultReadTimeout,
+				writeTimeout:    defaultWriteTimeout,
+				shutdownTimeout: defaultShutdownTimeout,
+				accessLogFormat: "text",
 			},
 		},
 		{
 			name: "env vars",
 			env: map[string]string{
-				"UNISRV_HOST":             "127.0.0.1",
-				"UNISRV_PORT":             "8080",
-				"UNISRV_BASE":             "/base1/",
-				"UNISRV_READ_TIMEOUT":     "10",
-				"UNISRV_WRITE_TIMEOUT":    "15",
-				"UNISRV_DISABLE_NO_CACHE": "true",
+				"UNISRV_HOST":                       "127.0.0.1",
+				"UNISRV_PORT":                       "8080",
+				"UNISRV_BASE":                       "/base1/",
+				"UNISRV_READ_TIMEOUT":               "10",
+				"UNISRV_WRITE_TIMEOUT":              "15",
+				"UNISRV_SHUTDOWN_TIMEOUT":           "30s",
+				"UNISRV_ACCESS_LOG":                 "access1.log",
+				"UNISRV_ACCESS_LOG_FORMAT":          "json",
+				"UNISRV_ACCESS_LOG_MAX_SIZE":        "10",
+				"UNISRV_ACCESS_LOG_ROTATE_INTERVAL": "1h",
+				"UNISRV_DISABLE_NO_CACHE":           "true",
+				"UNISRV_CACHE_RULE":                 "*.js=max-age=60;*.css=max-age=60",
+				"UNISRV_CACHE_PRESET":               "hashed",
+				"UNISRV_DISABLE_ETAG":               "true",
+				"UNISRV_WATCH":                      "true",
+				"UNISRV_FORWARD_CONSOLE":            "true",
+				"UNISRV_THROTTLE":                   "3g",
+				"UNISRV_THROTTLE_LATENCY":           "100ms",
+				"UNISRV_THROTTLE_RULE":              "*.html=none",
+				"UNISRV_FAULT":                      "*.data=503",
+				"UNISRV_METRICS":                    "true",
+				"UNISRV_METRICS_ADDR":               ":9100",
+				"UNISRV_QR":                         "true",
+				"UNISRV_OPEN":                       "true",
+				"UNISRV_BROWSER":                    "firefox",
+				"UNISRV_TLS":                        "true",
+				"UNISRV_TLS_CERT":                   "cert1.pem",
+				"UNISRV_TLS_KEY":                    "key1.pem",
+				"UNISRV_CROSS_ORIGIN_ISOLATION":     "credentialless",
+				"UNISRV_CORS_ORIGINS":               "*",
+				"UNISRV_CORS_METHODS":               "PUT",
+				"UNISRV_CORS_HEADERS":               "X-Foo",
+				"UNISRV_CORS_CREDENTIALS":           "true",
 			},
 			args: []string{},
 			cfg: &config{
-				host:           "127.0.0.1",
-				port:           8080,
-				base:           "/base1/",
-				readTimeout:    10,
-				writeTimeout:   15,
-				disableNoCache: true,
+				host:                    "127.0.0.1",
+				port:                    8080,
+				base:                    "/base1/",
+				readTimeout:             10,
+				writeTimeout:            15,
+				shutdownTimeout:         30 * time.Second,
+				accessLog:               "access1.log",
+				accessLogFormat:         "json",
+				accessLogMaxSize:        10,
+				accessLogRotateInterval: time.Hour,
+				disableNoCache:          true,
+				cacheRules:              "*.js=max-age=60;*.css=max-age=60",
+				cachePreset:             "hashed",
+				disableETag:             true,
+				watch:                   true,
+				forwardConsole:          true,
+				throttle:                "3g",
+				throttleLatency:         100 * time.Millisecond,
+				throttleRules:           "*.html=none",
+				faults:                  "*.data=503",
+				metrics:                 true,
+				metricsAddr:             ":9100",
+				qr:                      true,
+				open:                    true,
+				browser:                 "firefox",
+				tls:                     true,
+				tlsCert:                 "cert1.pem",
+				tlsKey:                  "key1.pem",
+				crossOriginIsolation:    "credentialless",
+				corsOrigins:             "*",
+				corsMethods:             "PUT",
+				corsHeaders:             "X-Foo",
+				corsCredentials:         true,
 			},
 		},
 		{
 			name: "args",
 			env: map[string]string{
-				"UNISRV_HOST":             "127.0.0.1",
-				"UNISRV_PORT":             "8080",
-				"UNISRV_BASE":             "/base1/",
-				"UNISRV_READ_TIMEOUT":     "10",
-				"UNISRV_WRITE_TIMEOUT":    "15",
-				"UNISRV_DISABLE_NO_CACHE": "true",
+				"UNISRV_HOST":                       "127.0.0.1",
+				"UNISRV_PORT":                       "8080",
+				"UNISRV_BASE":                       "/base1/",
+				"UNISRV_READ_TIMEOUT":               "10",
+				"UNISRV_WRITE_TIMEOUT":              "15",
+				"UNISRV_SHUTDOWN_TIMEOUT":           "30s",
+				"UNISRV_ACCESS_LOG":                 "access1.log",
+				"UNISRV_ACCESS_LOG_FORMAT":          "json",
+				"UNISRV_ACCESS_LOG_MAX_SIZE":        "10",
+				"UNISRV_ACCESS_LOG_ROTATE_INTERVAL": "1h",
+				"UNISRV_DISABLE_NO_CACHE":           "true",
+				"UNISRV_CACHE_RULE":                 "*.js=max-age=60;*.css=max-age=60",
+				"UNISRV_CACHE_PRESET":               "hashed",
+				"UNISRV_DISABLE_ETAG":               "true",
+				"UNISRV_WATCH":                      "true",
+				"UNISRV_FORWARD_CONSOLE":            "true",
+				"UNISRV_THROTTLE":                   "3g",
+				"UNISRV_THROTTLE_LATENCY":           "100ms",
+				"UNISRV_THROTTLE_RULE":              "*.html=none",
+				"UNISRV_FAULT":                      "*.data=503",
+				"UNISRV_METRICS":                    "true",
+				"UNISRV_METRICS_ADDR":               ":9100",
+				"UNISRV_QR":                         "true",
+				"UNISRV_OPEN":                       "true",
+				"UNISRV_BROWSER":                    "firefox",
+				"UNISRV_TLS":                        "true",
+				"UNISRV_TLS_CERT":                   "cert1.pem",
+				"UNISRV_TLS_KEY":                    "key1.pem",
+				"UNISRV_CROSS_ORIGIN_ISOLATION":     "credentialless",
+				"UNISRV_CORS_ORIGINS":               "*",
+				"UNISRV_CORS_METHODS":               "PUT",
+				"UNISRV_CORS_HEADERS":               "X-Foo",
+				"UNISRV_CORS_CREDENTIALS":           "true",
 			},
 			args: []string{
 				"-host", "1.1.1.1",
@@ -277,17 +580,63 @@ func TestParseCommandLineArgs(t *testing.T) {
 				"-base", "/base2/",
 				"-read-timeout", "20",
 				"-write-timeout", "25",
+				"-shutdown-timeout", "0",
+				"-access-log", "access2.log",
+				"-access-log-format", "combined",
+				"-access-log-max-size", "20",
+				"-access-log-rotate-interval", "24h",
 				"-disable-no-cache=false",
+				"-cache-rule", "*.html=no-store",
+				"-cache-rule", "*.wasm=max-age=60",
+				"-cache-preset", "",
+				"-disable-etag=false",
+				"-watch=false",
+				"-forward-console=false",
+				"-throttle", "500kbps",
+				"-throttle-latency", "1s",
+				"-throttle-rule", "*.data.br=slow-3g",
+				"-fault", "*.wasm=reset@0.5",
+				"-metrics=false",
+				"-metrics-addr", "localhost:9200",
+				"-qr=false",
+				"-open=false",
+				"-browser", "chromium --incognito",
+				"-tls=false",
+				"-tls-cert", "cert2.pem",
+				"-tls-key", "key2.pem",
+				"-cross-origin-isolation",
+				"-cors-origins", "https://example.com",
+				"-cors-methods", "DELETE",
+				"-cors-headers", "X-Bar",
+				"-cors-credentials=false",
 				"dir",
 			},
 			cfg: &config{
-				dir:            "dir",
-				host:           "1.1.1.1",
-				port:           9000,
-				base:           "/base2/",
-				readTimeout:    20,
-				writeTimeout:   25,
-				disableNoCache: false,
+				dir:                     "dir",
+				host:                    "1.1.1.1",
+				port:                    9000,
+				base:                    "/base2/",
+				readTimeout:             20,
+				writeTimeout:            25,
+				accessLog:               "access2.log",
+				accessLogFormat:         "combined",
+				accessLogMaxSize:        20,
+				accessLogRotateInterval: 24 * time.Hour,
+				disableNoCache:          false,
+				cacheRules:              "*.html=no-store;*.wasm=max-age=60;*.js=max-age=60;*.css=max-age=60",
+				throttle:                "500kbps",
+				throttleLatency:         time.Second,
+				throttleRules:           "*.data.br=slow-3g;*.html=none",
+				faults:                  "*.wasm=reset@0.5;*.data=503",
+				metricsAddr:             "localhost:9200",
+				browser:                 "chromium --incognito",
+				tlsCert:                 "cert2.pem",
+				tlsKey:                  "key2.pem",
+				crossOriginIsolation:    "require-corp",
+				corsOrigins:             "https://example.com",
+				corsMethods:             "DELETE",
+				corsHeaders:             "X-Bar",
+				corsCredentials:         false,
 			},
 		},
 		{
@@ -304,6 +653,13 @@ func TestParseCommandLineArgs(t *testing.T) {
 			},
 			failed: true,
 		},
+		{
+			name: "invalid cross-origin isolation",
+			args: []string{
+				"-cross-origin-isolation=same-origin",
+			},
+			failed: true,
+		},
 		{
 			name: "too many args",
 			args: []string{
@@ -311,6 +667,22 @@ func TestParseCommandLineArgs(t *testing.T) {
 			},
 			failed: true,
 		},
+		{
+			name: "invalid int env var",
+			env: map[string]string{
+				"UNISRV_PORT": "abc",
+			},
+			args:   []string{},
+			failed: true,
+		},
+		{
+			name: "invalid bool env var",
+			env: map[string]string{
+				"UNISRV_DISABLE_NO_CACHE": "yes",
+			},
+			args:   []string{},
+			failed: true,
+		},
 	}
 
 	for _, v := range cases {
@@ -393,7 +765,7 @@ func TestNewServer(t *testing.T) {
 
 	for _, v := range cases {
 		t.Run(v.name, func(tt *testing.T) {
-			srv := newServer(v.cfg)
+			srv := newServer(v.cfg, os.DirFS(v.cfg.dir), io.Discard, nil)
 			defer srv.Close()
 
 			tt.Run("read timeout", func(ttt *testing.T) {
@@ -451,3 +823,393 @@ func TestNewServer(t *testing.T) {
 		})
 	}
 }
+
+func TestNewServerWatch(t *testing.T) {
+	cfg := &config{
+		dir:   "testdata",
+		host:  "localhost",
+		base:  "/",
+		watch: true,
+	}
+
+	srv := newServer(cfg, os.DirFS(cfg.dir), io.Discard, nil)
+	defer srv.Shutdown(context.Background()) //nolint:errcheck
+
+	listener, err := net.Listen("tcp", cfg.addr())
+	if err != nil {
+		t.Fatalf("listen failed: %+v", err)
+	}
+	defer listener.Close()
+
+	go srv.Serve(listener) //nolint:errcheck
+
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	resp, err := http.Get(cfg.url(port))
+	if err != nil {
+		t.Fatalf("request failed: %+v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read failed: %+v", err)
+	}
+
+	if !strings.Contains(string(b), "/__unisrv/livereload") {
+		t.Errorf("live reload script is not injected: %q", string(b))
+	}
+}
+
+func TestNewServerWatchSymbols(t *testing.T) {
+	dir := t.TempDir()
+	symbolsFile := filepath.Join(dir, "Build", "Build.symbols.json")
+	writeSymbols := func(name string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(symbolsFile), 0o755); err != nil {
+			t.Fatalf("mkdir failed: %+v", err)
+		}
+		if err := os.WriteFile(symbolsFile, []byte(`{"12":"`+name+`"}`), 0o600); err != nil {
+			t.Fatalf("write failed: %+v", err)
+		}
+	}
+	writeSymbols("Old_Update")
+
+	cfg := &config{
+		dir:   dir,
+		host:  "localhost",
+		base:  "/",
+		watch: true,
+	}
+
+	srv := newServer(cfg, os.DirFS(cfg.dir), io.Discard, nil)
+	defer srv.Shutdown(context.Background()) //nolint:errcheck
+
+	listener, err := net.Listen("tcp", cfg.addr())
+	if err != nil {
+		t.Fatalf("listen failed: %+v", err)
+	}
+	defer listener.Close()
+
+	go srv.Serve(listener) //nolint:errcheck
+
+	symbolicate := func() string {
+		t.Helper()
+		url := cfg.url(listener.Addr().(*net.TCPAddr).Port) + "__unisrv/symbolicate"
+		resp, err := http.Post(url, "text/plain", strings.NewReader("at wasm-function[12]"))
+		if err != nil {
+			t.Fatalf("request failed: %+v", err)
+		}
+		defer resp.Body.Close()
+
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("read failed: %+v", err)
+		}
+		return string(b)
+	}
+
+	if actual, expected := symbolicate(), "at Old_Update"; actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+
+	writeSymbols("New_Update")
+
+	expected := "at New_Update"
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		actual := symbolicate()
+		if actual == expected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q after the rebuild, but got %q", expected, actual)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestNewServerFaults(t *testing.T) {
+	cfg := &config{
+		dir:    "testdata",
+		host:   "localhost",
+		base:   "/",
+		faults: "*.html=503",
+	}
+
+	srv := newServer(cfg, os.DirFS(cfg.dir), io.Discard, nil)
+	defer srv.Close()
+
+	listener, err := net.Listen("tcp", cfg.addr())
+	if err != nil {
+		t.Fatalf("listen failed: %+v", err)
+	}
+	defer listener.Close()
+
+	go srv.Serve(listener) //nolint:errcheck
+
+	url := cfg.url(listener.Addr().(*net.TCPAddr).Port)
+
+	get := func() int {
+		resp, err := http.Get(url + "index.html")
+		if err != nil {
+			t.Fatalf("request failed: %+v", err)
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := get(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected %d, but got %d", http.StatusServiceUnavailable, code)
+	}
+
+	resp, err := http.Post(url+faultsEndpoint+"?enabled=false", "", nil)
+	if err != nil {
+		t.Fatalf("request failed: %+v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d, but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if code := get(); code != http.StatusOK {
+		t.Errorf("expected %d, but got %d", http.StatusOK, code)
+	}
+}
+
+func TestNewServerMetrics(t *testing.T) {
+	cases := []struct {
+		name        string
+		base        string
+		metricsAddr string
+		exposed     bool
+	}{
+		{
+			name:    "same listener",
+			base:    "/",
+			exposed: true,
+		},
+		{
+			name:    "same listener with base",
+			base:    "/base/",
+			exposed: true,
+		},
+		{
+			name:        "separate listener",
+			base:        "/",
+			metricsAddr: "localhost:0",
+			exposed:     false,
+		},
+	}
+
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte("index")},
+		"metrics":    {Data: []byte("build file")},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			cfg := &config{
+				host:        "localhost",
+				base:        v.base,
+				metrics:     true,
+				metricsAddr: v.metricsAddr,
+			}
+			metrics := middleware.NewMetrics()
+
+			srv := newServer(cfg, fsys, io.Discard, metrics)
+			defer srv.Close()
+
+			listener, err := net.Listen("tcp", cfg.addr())
+			if err != nil {
+				tt.Fatalf("listen failed: %+v", err)
+			}
+			defer listener.Close()
+
+			go srv.Serve(listener) //nolint:errcheck
+
+			url := cfg.url(listener.Addr().(*net.TCPAddr).Port)
+
+			get := func(url string) string {
+				resp, err := http.Get(url)
+				if err != nil {
+					tt.Fatalf("request failed: %+v", err)
+				}
+				defer resp.Body.Close()
+
+				b, err := io.ReadAll(resp.Body)
+				if err != nil {
+					tt.Fatalf("read failed: %+v", err)
+				}
+				return string(b)
+			}
+
+			// The metrics must not shadow a build file of the same name.
+			if body := get(url + "metrics"); body != "build file" {
+				tt.Errorf("expected %q, but got %q", "build file", body)
+			}
+
+			body := get(url + metricsEndpoint)
+			expected := `unisrv_http_requests_total{asset="other",encoding="identity",status="200"} 1`
+			if exposed := strings.Contains(body, expected); exposed != v.exposed {
+				tt.Errorf("expected exposed to be %v, but got %v: %q", v.exposed, exposed, body)
+			}
+		})
+	}
+}
+
+func TestOpenFS(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "build.zip")
+
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatalf("failed to create archive: %+v", err)
+	}
+
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("index.html")
+	if err != nil {
+		t.Fatalf("failed to create entry: %+v", err)
+	}
+	fmt.Fprint(w, "archive\n")
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %+v", err)
+	}
+	f.Close()
+
+	cases := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{
+			name:     "directory",
+			path:     "testdata",
+			expected: "testdata\n",
+		},
+		{
+			name:     "archive",
+			path:     archive,
+			expected: "archive\n",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			fsys, closeFS, err := openFS(v.path)
+			if err != nil {
+				tt.Fatalf("failed to open: %+v", err)
+			}
+			defer closeFS() //nolint:errcheck
+
+			b, err := fs.ReadFile(fsys, "index.html")
+			if err != nil {
+				tt.Fatalf("failed to read index.html: %+v", err)
+			}
+
+			if string(b) != v.expected {
+				tt.Errorf("expected %q, but got %q", v.expected, string(b))
+			}
+		})
+	}
+}
+
+func TestConfigThrottleConfig(t *testing.T) {
+	t.Run("disabled", func(tt *testing.T) {
+		throttle, err := (&config{}).throttleConfig()
+		if err != nil {
+			tt.Fatalf("unexpected error: %+v", err)
+		}
+		if throttle != nil {
+			tt.Errorf("expected nil, but got %+v", throttle)
+		}
+	})
+
+	t.Run("enabled", func(tt *testing.T) {
+		cfg := &config{
+			base:            "/base/",
+			throttle:        "3g",
+			throttleLatency: time.Second,
+			throttleRules:   "*.html=none; Build/*=800",
+		}
+
+		throttle, err := cfg.throttleConfig()
+		if err != nil {
+			tt.Fatalf("unexpected error: %+v", err)
+		}
+
+		expected := middleware.ThrottleProfile{
+			Bandwidth: middleware.ThrottlePresets["3g"].Bandwidth,
+			Latency:   time.Second,
+		}
+		if throttle.Default != expected {
+			tt.Errorf("expected %+v, but got %+v", expected, throttle.Default)
+		}
+
+		rules := make([]string, len(throttle.Rules))
+		for i, rule := range throttle.Rules {
+			rules[i] = fmt.Sprintf("%s=%d", rule.Pattern, rule.Profile.Bandwidth)
+		}
+		expectedRules := []string{"*.html=0", "Build/*=100000"}
+		if !reflect.DeepEqual(rules, expectedRules) {
+			tt.Errorf("expected %q, but got %q", expectedRules, rules)
+		}
+	})
+}
+
+func TestParseCommandLineArgsListPrecedence(t *testing.T) {
+	t.Setenv("UNISRV_CACHE_RULE", "*.data=max-age=120")
+	t.Setenv("UNISRV_THROTTLE_RULE", "*.data=3g")
+	t.Setenv("UNISRV_FAULT", "*.data=500")
+
+	args := []string{"-cache-rule", "*.data=no-store", "-throttle-rule", "*.data=none", "-fault", "*.data=503"}
+	cfg, _, err := parseCommandLineArgs(args)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	// Rules are matched in order, so the ones from the command line must come first.
+	const name = "Build/Build.data"
+
+	t.Run("cache-rule", func(tt *testing.T) {
+		rules, err := parseCacheRules(cfg.cacheRules)
+		if err != nil {
+			tt.Fatalf("unexpected error: %+v", err)
+		}
+		if expected := "no-store"; rules[0].CacheControl != expected {
+			tt.Errorf("expected %q, but got %q", expected, rules[0].CacheControl)
+		}
+	})
+
+	t.Run("throttle-rule", func(tt *testing.T) {
+		throttle, err := cfg.throttleConfig()
+		if err != nil {
+			tt.Fatalf("unexpected error: %+v", err)
+		}
+		for _, rule := range throttle.Rules {
+			if rule.Pattern.Match(name) {
+				if rule.Profile.Bandwidth != 0 {
+					tt.Errorf("expected no throttling, but got %#v", rule.Profile)
+				}
+				return
+			}
+		}
+		tt.Errorf("no rule matched")
+	})
+
+	t.Run("fault", func(tt *testing.T) {
+		rules, err := cfg.faultRules()
+		if err != nil {
+			tt.Fatalf("unexpected error: %+v", err)
+		}
+		for _, rule := range rules {
+			if rule.Pattern.Match(name) {
+				if rule.Action.Status != http.StatusServiceUnavailable {
+					tt.Errorf("expected %d, but got %d", http.StatusServiceUnavailable, rule.Action.Status)
+				}
+				return
+			}
+		}
+		tt.Errorf("no rule matched")
+	})
+}
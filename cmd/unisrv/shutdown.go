@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// connContextKey is the context key of the tracked connection serving the request.
+type connContextKey struct{}
+
+// trackedConn is a connection tracked by the tracker.
+type trackedConn struct {
+	tracker *connTracker
+	conn    net.Conn
+}
+
+// connTracker tracks connections of a server via http.Server.ConnState.
+// Only the connections serving requests other than event streams are counted,
+// since idle keep-alive connections are closed immediately
+// and event streams never end by themselves on shutdown.
+type connTracker struct {
+	mu      sync.Mutex
+	conns   map[net.Conn]http.ConnState
+	streams map[net.Conn]struct{}
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{
+		conns:   map[net.Conn]http.ConnState{},
+		streams: map[net.Conn]struct{}{},
+	}
+}
+
+// attach sets the tracker to the server.
+func (t *connTracker) attach(srv *http.Server) {
+	srv.ConnState = t.track
+	srv.ConnContext = func(ctx context.Context, conn net.Conn) context.Context {
+		return context.WithValue(ctx, connContextKey{}, trackedConn{tracker: t, conn: conn})
+	}
+}
+
+// track is set to http.Server.ConnState.
+// Hijacked connections are no longer tracked since the server does not close them.
+// A stream ends when the connection becomes idle or is closed.
+func (t *connTracker) track(conn net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch state {
+	case http.StateNew, http.StateActive:
+		t.conns[conn] = state
+	case http.StateIdle:
+		t.conns[conn] = state
+		delete(t.streams, conn)
+	case http.StateClosed, http.StateHijacked:
+		delete(t.conns, conn)
+		delete(t.streams, conn)
+	}
+}
+
+// markStream excludes the connection serving the request from the count while it serves the event stream.
+// It is registered with unisrv.LiveReload.OnStream, and does nothing for servers without a tracker.
+// The streams are closed on shutdown by the server, see http.Server.RegisterOnShutdown.
+func markStream(r *http.Request) {
+	c, ok := r.Context().Value(connContextKey{}).(trackedConn)
+	if !ok {
+		return
+	}
+
+	c.tracker.mu.Lock()
+	defer c.tracker.mu.Unlock()
+	if _, ok := c.tracker.conns[c.conn]; ok {
+		c.tracker.streams[c.conn] = struct{}{}
+	}
+}
+
+// count returns the number of connections serving requests other than event streams.
+func (t *connTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for conn, state := range t.conns {
+		if _, ok := t.streams[conn]; state == http.StateActive && !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// shutdown gracefully shuts down the server, waiting for active connections to be drained
+// until the timeout expires or a signal is received from force.
+// The remaining connections are closed then. A zero timeout means no timeout.
+// The auxiliary servers, e.g. the metrics server, are shut down within the same time,
+// but their connections are not counted.
+// It returns the numbers of the connections drained and killed.
+func shutdown(
+	srv *http.Server, conns *connTracker, timeout time.Duration, force <-chan os.Signal, aux ...*http.Server,
+) (drained, killed int, err error) {
+	total := conns.count()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	go func() {
+		select {
+		case <-force:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	errs := make(chan error, len(aux))
+	for _, s := range aux {
+		go func() {
+			errs <- closeOnShutdownError(s, s.Shutdown(ctx))
+		}()
+	}
+
+	if err = srv.Shutdown(ctx); err != nil {
+		killed = conns.count()
+		err = closeOnShutdownError(srv, err)
+	}
+
+	for range aux {
+		err = errors.Join(err, <-errs)
+	}
+
+	return max(total-killed, 0), killed, err
+}
+
+// closeOnShutdownError closes the server if it has failed to shut down gracefully with err,
+// e.g. the timeout has expired. Cancellation and the timeout are not reported as errors.
+func closeOnShutdownError(srv *http.Server, err error) error {
+	if err == nil {
+		return nil
+	}
+	if closeErr := srv.Close(); closeErr != nil {
+		return fmt.Errorf("close: %w", closeErr)
+	}
+	if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	const maxDelay = 5 * time.Second
+
+	cases := []struct {
+		name    string
+		delay   time.Duration
+		timeout time.Duration
+		force   bool
+		drained int
+		killed  int
+	}{
+		{
+			name:    "drained",
+			delay:   100 * time.Millisecond,
+			timeout: 5 * time.Second,
+			drained: 1,
+			killed:  0,
+		},
+		{
+			name:    "timeout",
+			delay:   time.Minute,
+			timeout: 100 * time.Millisecond,
+			drained: 0,
+			killed:  1,
+		},
+		{
+			name:    "force",
+			delay:   time.Minute,
+			timeout: 0,
+			force:   true,
+			drained: 0,
+			killed:  1,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			started := make(chan struct{})
+			srv := &http.Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+					select {
+					case <-time.After(v.delay):
+						fmt.Fprint(w, "ok")
+					case <-r.Context().Done():
+					}
+				}),
+				ReadHeaderTimeout: time.Second,
+			}
+			conns := newConnTracker()
+			conns.attach(srv)
+
+			listener, err := net.Listen("tcp", "localhost:0")
+			if err != nil {
+				tt.Fatalf("listen failed: %+v", err)
+			}
+			defer listener.Close()
+
+			go srv.Serve(listener) //nolint:errcheck
+
+			go func() {
+				resp, err := http.Get("http://" + listener.Addr().String())
+				if err == nil {
+					resp.Body.Close()
+				}
+			}()
+			<-started
+
+			if n := conns.count(); n != 1 {
+				tt.Fatalf("expected %d, but got %d", 1, n)
+			}
+
+			force := make(chan os.Signal, 1)
+			if v.force {
+				force <- os.Interrupt
+			}
+
+			start := time.Now()
+			drained, killed, err := shutdown(srv, conns, v.timeout, force)
+			if err != nil {
+				tt.Fatalf("unexpected error: %+v", err)
+			}
+
+			if elapsed := time.Since(start); elapsed > maxDelay {
+				tt.Errorf("expected shutdown within %v, but took %v", maxDelay, elapsed)
+			}
+			if drained != v.drained {
+				tt.Errorf("expected %d drained, but got %d", v.drained, drained)
+			}
+			if killed != v.killed {
+				tt.Errorf("expected %d killed, but got %d", v.killed, killed)
+			}
+		})
+	}
+}
+
+func TestShutdownExcludedConnections(t *testing.T) {
+	started := make(chan string, 2)
+	closed := make(chan struct{})
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/stream":
+				markStream(r)
+				w.Header().Set("Content-Type", "text/event-stream")
+			case "/download":
+				// Claiming an event stream in the request does not exclude the connection.
+			default:
+				fmt.Fprint(w, "ok")
+				return
+			}
+			http.NewResponseController(w).Flush() //nolint:errcheck
+			started <- r.URL.Path
+			select {
+			case <-closed:
+			case <-r.Context().Done():
+			}
+		}),
+		ReadHeaderTimeout: time.Second,
+	}
+	srv.RegisterOnShutdown(func() {
+		close(closed)
+	})
+	conns := newConnTracker()
+	conns.attach(srv)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen failed: %+v", err)
+	}
+	defer listener.Close()
+
+	go srv.Serve(listener) //nolint:errcheck
+
+	url := "http://" + listener.Addr().String()
+
+	// The connection is kept alive and idle after the response.
+	client := &http.Client{Transport: &http.Transport{}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("request failed: %+v", err)
+	}
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+	resp.Body.Close()
+
+	for _, path := range []string{"/stream", "/download"} {
+		req, err := http.NewRequest(http.MethodGet, url+path, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %+v", err)
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		go func() {
+			resp, err := (&http.Client{Transport: &http.Transport{}}).Do(req)
+			if err == nil {
+				io.Copy(io.Discard, resp.Body) //nolint:errcheck
+				resp.Body.Close()
+			}
+		}()
+		<-started
+	}
+
+	// The server marks the connection idle after the client has read the response.
+	deadline := time.Now().Add(5 * time.Second)
+	for conns.count() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := conns.count(); n != 1 {
+		t.Fatalf("expected %d, but got %d", 1, n)
+	}
+
+	drained, killed, err := shutdown(srv, conns, 5*time.Second, make(chan os.Signal))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if drained != 1 || killed != 0 {
+		t.Errorf("expected %d drained and %d killed, but got %d and %d", 1, 0, drained, killed)
+	}
+}
+
+func TestNewServerLiveReloadStream(t *testing.T) {
+	cfg := &config{
+		dir:   "testdata",
+		host:  "localhost",
+		base:  "/",
+		watch: true,
+	}
+
+	srv := newServer(cfg, os.DirFS(cfg.dir), io.Discard, nil)
+	defer srv.Close()
+	conns := newConnTracker()
+	conns.attach(srv)
+
+	listener, err := net.Listen("tcp", cfg.addr())
+	if err != nil {
+		t.Fatalf("listen failed: %+v", err)
+	}
+	defer listener.Close()
+
+	go srv.Serve(listener) //nolint:errcheck
+
+	resp, err := http.Get(cfg.url(listener.Addr().(*net.TCPAddr).Port) + "__unisrv/livereload")
+	if err != nil {
+		t.Fatalf("request failed: %+v", err)
+	}
+	defer resp.Body.Close()
+
+	conns.mu.Lock()
+	active := 0
+	for _, state := range conns.conns {
+		if state == http.StateActive {
+			active++
+		}
+	}
+	conns.mu.Unlock()
+	if active != 1 {
+		t.Fatalf("expected %d active connection, but got %d", 1, active)
+	}
+
+	if n := conns.count(); n != 0 {
+		t.Errorf("expected %d, but got %d", 0, n)
+	}
+}
+
+func TestShutdownAuxiliaryServers(t *testing.T) {
+	const maxDelay = 5 * time.Second
+
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	aux := &http.Server{
+		Handler: http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			close(started)
+			select {
+			case <-time.After(time.Minute):
+			case <-r.Context().Done():
+				close(canceled)
+			}
+		}),
+		ReadHeaderTimeout: time.Second,
+	}
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen failed: %+v", err)
+	}
+	defer listener.Close()
+
+	go aux.Serve(listener) //nolint:errcheck
+
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	srv := &http.Server{ReadHeaderTimeout: time.Second}
+	conns := newConnTracker()
+	conns.attach(srv)
+
+	start := time.Now()
+	if _, _, err := shutdown(srv, conns, 100*time.Millisecond, make(chan os.Signal), aux); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > maxDelay {
+		t.Errorf("expected shutdown within %v, but took %v", maxDelay, elapsed)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(maxDelay):
+		t.Errorf("expected the request to the auxiliary server to be canceled")
+	}
+}
+
+func TestConnTracker(t *testing.T) {
+	conns := newConnTracker()
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	cases := []struct {
+		name     string
+		conn     net.Conn
+		state    http.ConnState
+		expected int
+	}{
+		{name: "new a", conn: a, state: http.StateNew, expected: 0},
+		{name: "active a", conn: a, state: http.StateActive, expected: 1},
+		{name: "new b", conn: b, state: http.StateNew, expected: 1},
+		{name: "active b", conn: b, state: http.StateActive, expected: 2},
+		{name: "idle a", conn: a, state: http.StateIdle, expected: 1},
+		{name: "hijacked b", conn: b, state: http.StateHijacked, expected: 0},
+		{name: "closed a", conn: a, state: http.StateClosed, expected: 0},
+	}
+
+	for _, v := range cases {
+		conns.track(v.conn, v.state)
+		if n := conns.count(); n != v.expected {
+			t.Errorf("%s: expected %d, but got %d", v.name, v.expected, n)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+// maxTraceLineSize is the maximum size of a line of stack traces to symbolicate.
+const maxTraceLineSize = 1 << 20
+
+// symbolicateConfig is config of symbolicate command.
+type symbolicateConfig struct {
+	symbols string
+	files   []string
+}
+
+// parseSymbolicateArgs parses given arguments of symbolicate command.
+func parseSymbolicateArgs(args []string) (*symbolicateConfig, error) {
+	cfg := &symbolicateConfig{}
+
+	fs := flag.NewFlagSet("unisrv symbolicate", flag.ContinueOnError)
+	fs.StringVar(&cfg.symbols, "symbols", ".", "symbols file, or build directory or archive containing it")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: unisrv symbolicate [flags] [file ...]\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("parse flags: %w", err)
+	}
+
+	cfg.files = fs.Args()
+
+	return cfg, nil
+}
+
+// runSymbolicate symbolicates stack traces in the files, or read from r if no file is given, and writes them to w.
+func runSymbolicate(cfg *symbolicateConfig, r io.Reader, w io.Writer) error {
+	symbols, err := openSymbols(cfg.symbols)
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.files) == 0 {
+		return symbolicate(symbols, r, w)
+	}
+
+	for _, name := range cfg.files {
+		if err := symbolicateFile(symbols, name, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// symbolicateFile symbolicates stack traces in the named file.
+func symbolicateFile(symbols *unisrv.Symbols, name string, w io.Writer) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	return symbolicate(symbols, f, w)
+}
+
+// symbolicate symbolicates stack traces read from r line by line so that piped logs are written immediately.
+func symbolicate(symbols *unisrv.Symbols, r io.Reader, w io.Writer) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxTraceLineSize)
+	for sc.Scan() {
+		if _, err := fmt.Fprintln(w, symbols.Symbolicate(sc.Text())); err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	return nil
+}
+
+// openSymbols loads the symbols file.
+// The name may be the symbols file itself, or a directory or an archive containing it.
+func openSymbols(name string) (*unisrv.Symbols, error) {
+	if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() && !unisrv.IsArchive(name) {
+		symbols, err := unisrv.LoadSymbols(os.DirFS(filepath.Dir(name)), filepath.Base(name))
+		if err != nil {
+			return nil, fmt.Errorf("load symbols: %w", err)
+		}
+		return symbols, nil
+	}
+
+	fsys, closeFS, err := openFS(name)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", name, err)
+	}
+	defer closeFS() //nolint:errcheck
+
+	return findSymbols(fsys)
+}
+
+// findSymbols loads the symbols file in fsys.
+func findSymbols(fsys fs.FS) (*unisrv.Symbols, error) {
+	symbolsName, err := unisrv.FindSymbols(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("find symbols: %w", err)
+	}
+
+	symbols, err := unisrv.LoadSymbols(fsys, symbolsName)
+	if err != nil {
+		return nil, fmt.Errorf("load symbols: %w", err)
+	}
+	return symbols, nil
+}
+
+// loadServerSymbols loads the symbols file served by the server if it exists.
+func loadServerSymbols(fsys fs.FS) *unisrv.Symbols {
+	symbols, err := findSymbols(fsys)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintln(os.Stderr, "warning: symbolication is disabled:", err)
+		}
+		return nil
+	}
+	return symbols
+}
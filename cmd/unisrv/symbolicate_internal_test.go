@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSymbolicateArgs(t *testing.T) {
+	cases := []struct {
+		name   string
+		args   []string
+		cfg    *symbolicateConfig
+		failed bool
+	}{
+		{
+			name: "default",
+			args: []string{},
+			cfg: &symbolicateConfig{
+				symbols: ".",
+				files:   []string{},
+			},
+		},
+		{
+			name: "args",
+			args: []string{"-symbols", "Build/Build.symbols.json", "a.log", "b.log"},
+			cfg: &symbolicateConfig{
+				symbols: "Build/Build.symbols.json",
+				files:   []string{"a.log", "b.log"},
+			},
+		},
+		{
+			name:   "invalid args",
+			args:   []string{"-unknown"},
+			failed: true,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			cfg, err := parseSymbolicateArgs(v.args)
+
+			switch {
+			case err != nil && !v.failed:
+				tt.Errorf("unexpected error")
+			case err == nil && v.failed:
+				tt.Errorf("unexpected success")
+			default:
+				// nop
+			}
+
+			if v.failed || tt.Failed() {
+				return
+			}
+
+			if !reflect.DeepEqual(cfg, v.cfg) {
+				tt.Errorf("expected %#v, but got %#v", v.cfg, cfg)
+			}
+		})
+	}
+}
+
+func TestRunSymbolicate(t *testing.T) {
+	dir := t.TempDir()
+	buildDir := filepath.Join(dir, "Build")
+	if err := os.Mkdir(buildDir, 0o755); err != nil {
+		t.Fatalf("mkdir failed: %+v", err)
+	}
+	symbolsFile := filepath.Join(buildDir, "Build.symbols.json")
+	if err := os.WriteFile(symbolsFile, []byte(`{"functions":{"1":"Foo_Bar_m1"}}`), 0o600); err != nil {
+		t.Fatalf("write failed: %+v", err)
+	}
+	logFile := filepath.Join(dir, "error.log")
+	if err := os.WriteFile(logFile, []byte("at wasm-function[1]:0x10\n"), 0o600); err != nil {
+		t.Fatalf("write failed: %+v", err)
+	}
+
+	cases := []struct {
+		name     string
+		cfg      *symbolicateConfig
+		input    string
+		expected string
+		notExist bool
+	}{
+		{
+			name:     "build directory and stdin",
+			cfg:      &symbolicateConfig{symbols: dir},
+			input:    "at wasm-function[1]:0x10\nat wasm-function[2]:0x20",
+			expected: "at Foo_Bar_m1:0x10\nat wasm-function[2]:0x20\n",
+		},
+		{
+			name:     "symbols file and files",
+			cfg:      &symbolicateConfig{symbols: symbolsFile, files: []string{logFile, logFile}},
+			expected: "at Foo_Bar_m1:0x10\nat Foo_Bar_m1:0x10\n",
+		},
+		{
+			name:     "no symbols",
+			cfg:      &symbolicateConfig{symbols: filepath.Join(buildDir, "missing")},
+			notExist: true,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			var out strings.Builder
+			err := runSymbolicate(v.cfg, strings.NewReader(v.input), &out)
+
+			switch {
+			case v.notExist:
+				if !errors.Is(err, fs.ErrNotExist) {
+					tt.Fatalf("expected fs.ErrNotExist, but got %v", err)
+				}
+			case err != nil:
+				tt.Fatalf("unexpected error: %+v", err)
+			default:
+				// nop
+			}
+
+			if actual := out.String(); actual != v.expected {
+				tt.Errorf("expected %q, but got %q", v.expected, actual)
+			}
+		})
+	}
+}
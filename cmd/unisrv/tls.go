@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/frozenbonito/unisrv/internal/localca"
+)
+
+// newTLSConfig returns TLS config of the server.
+// If no certificate is given, a certificate signed by the local CA in the user config directory is used.
+func newTLSConfig(cfg *config) (*tls.Config, error) {
+	var cert tls.Certificate
+	if cfg.tlsCert != "" {
+		var err error
+		cert, err = tls.LoadX509KeyPair(cfg.tlsCert, cfg.tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("load certificate: %w", err)
+		}
+	} else {
+		dir, err := certDir()
+		if err != nil {
+			return nil, err
+		}
+		cert, err = localca.LoadOrCreate(dir, certHosts(cfg.host))
+		if err != nil {
+			return nil, fmt.Errorf("issue local certificate: %w", err)
+		}
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// certDir returns the directory of the local CA and certificate.
+func certDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("user config directory: %w", err)
+	}
+	return filepath.Join(dir, "unisrv", "certs"), nil
+}
+
+// certHosts returns host names and IP addresses the local certificate should cover.
+func certHosts(host string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if host != "" && !isUnspecified(host) && host != "localhost" {
+		hosts = append(hosts, host)
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+	}
+	for _, ip := range lanAddrs() {
+		hosts = append(hosts, ip.String())
+	}
+	return hosts
+}
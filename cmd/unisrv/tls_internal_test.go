@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/frozenbonito/unisrv/internal/localca"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+
+	dir, err := certDir()
+	if err != nil {
+		t.Fatalf("cert dir failed: %+v", err)
+	}
+
+	cases := []struct {
+		name string
+		cfg  *config
+	}{
+		{
+			name: "local CA",
+			cfg: &config{
+				dir:  "testdata",
+				host: "localhost",
+				base: "/",
+				tls:  true,
+			},
+		},
+		{
+			name: "certificate files",
+			cfg: &config{
+				dir:     "testdata",
+				host:    "localhost",
+				base:    "/",
+				tlsCert: filepath.Join(dir, localca.CertFile),
+				tlsKey:  filepath.Join(dir, localca.KeyFile),
+			},
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			srv := newServer(v.cfg, os.DirFS(v.cfg.dir), io.Discard, nil)
+			defer srv.Close()
+
+			srv.TLSConfig, err = newTLSConfig(v.cfg)
+			if err != nil {
+				tt.Fatalf("tls config failed: %+v", err)
+			}
+
+			listener, err := net.Listen("tcp", v.cfg.addr())
+			if err != nil {
+				tt.Fatalf("listen failed: %+v", err)
+			}
+			defer listener.Close()
+
+			go srv.ServeTLS(listener, "", "") //nolint:errcheck
+
+			caPEM, err := os.ReadFile(filepath.Join(dir, localca.CACertFile))
+			if err != nil {
+				tt.Fatalf("read CA failed: %+v", err)
+			}
+			roots := x509.NewCertPool()
+			roots.AppendCertsFromPEM(caPEM)
+
+			client := &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig:   &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+					ForceAttemptHTTP2: true,
+				},
+			}
+
+			resp, err := client.Get(v.cfg.url(listener.Addr().(*net.TCPAddr).Port))
+			if err != nil {
+				tt.Fatalf("request failed: %+v", err)
+			}
+			defer resp.Body.Close()
+
+			tt.Run("status code", func(ttt *testing.T) {
+				if resp.StatusCode != http.StatusOK {
+					ttt.Errorf("expected %d, but got %d", http.StatusOK, resp.StatusCode)
+				}
+			})
+
+			tt.Run("protocol", func(ttt *testing.T) {
+				if resp.ProtoMajor != 2 {
+					ttt.Errorf("expected HTTP/2, but got %s", resp.Proto)
+				}
+			})
+		})
+	}
+}
+
+func TestCertHosts(t *testing.T) {
+	hosts := certHosts("0.0.0.0")
+	for _, expected := range []string{"localhost", "127.0.0.1", "::1"} {
+		if !slices.Contains(hosts, expected) {
+			t.Errorf("expected %q to be included in %q", expected, hosts)
+		}
+	}
+	if slices.Contains(hosts, "0.0.0.0") {
+		t.Errorf("expected unspecified address to be excluded from %q", hosts)
+	}
+
+	if hosts := certHosts("example.test"); !slices.Contains(hosts, "example.test") {
+		t.Errorf("expected %q to be included in %q", "example.test", hosts)
+	}
+}
@@ -0,0 +1,123 @@
+package unisrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// consolePath is the path of the endpoint receiving forwarded console messages.
+const consolePath = internalPathPrefix + "console"
+
+// maxConsoleBodySize is the maximum size of a request body of the console endpoint.
+const maxConsoleBodySize = 1 << 20
+
+// consoleScript is the client script injected into HTML documents to forward console output.
+// The placeholder is replaced with the URL of the console endpoint.
+const consoleScript = `<script>
+(() => {
+  const url = %q;
+  const client = Math.random().toString(36).slice(2, 8);
+  let queue = [];
+  let timer = 0;
+
+  const format = (arg) => {
+    if (typeof arg === "string") return arg;
+    if (arg instanceof Error) return arg.stack || String(arg);
+    try {
+      return JSON.stringify(arg);
+    } catch {
+      return String(arg);
+    }
+  };
+
+  const flush = (beacon) => {
+    timer = 0;
+    if (queue.length === 0) return;
+    const body = JSON.stringify({ client, messages: queue });
+    queue = [];
+    if (beacon && navigator.sendBeacon) {
+      navigator.sendBeacon(url, body);
+      return;
+    }
+    fetch(url, { method: "POST", body, keepalive: true }).catch(() => {});
+  };
+
+  const send = (level, args) => {
+    queue.push({ level, time: Date.now(), text: args.map(format).join(" ") });
+    if (!timer) timer = setTimeout(flush, 100);
+  };
+
+  for (const level of ["debug", "log", "info", "warn", "error"]) {
+    const original = console[level];
+    console[level] = (...args) => {
+      send(level, args);
+      original.apply(console, args);
+    };
+  }
+
+  addEventListener("error", (e) => send("error", [e.error || e.message]));
+  addEventListener("unhandledrejection", (e) => send("error", ["Unhandled rejection:", e.reason]));
+  addEventListener("pagehide", () => flush(true));
+})();
+</script>
+`
+
+// ConsoleMessage is a message of the browser console forwarded by the injected script.
+type ConsoleMessage struct {
+	// Client is the identifier of the page which generated the message.
+	// It is generated randomly every page load.
+	Client string
+	// RemoteAddr is the network address of the client.
+	RemoteAddr string
+	// UserAgent is the user agent of the client.
+	UserAgent string
+	// Level is the console method, e.g. `log`, `warn` or `error`.
+	// Uncaught errors and unhandled rejections are reported as `error`.
+	Level string
+	// Time is the time the message was generated in the browser.
+	Time time.Time
+	// Text is the formatted message.
+	Text string
+}
+
+// consoleRequest is the request body of the console endpoint.
+type consoleRequest struct {
+	Client   string `json:"client"`
+	Messages []struct {
+		Level string `json:"level"`
+		Time  int64  `json:"time"`
+		Text  string `json:"text"`
+	} `json:"messages"`
+}
+
+// consoleHandler returns a handler of the console endpoint which calls forward for each message.
+func consoleHandler(forward func(msg *ConsoleMessage)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req consoleRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConsoleBodySize)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid console messages: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		for _, m := range req.Messages {
+			forward(&ConsoleMessage{
+				Client:     req.Client,
+				RemoteAddr: r.RemoteAddr,
+				UserAgent:  r.UserAgent(),
+				Level:      m.Level,
+				Time:       time.UnixMilli(m.Time),
+				Text:       m.Text,
+			})
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
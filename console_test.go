@@ -0,0 +1,131 @@
+package unisrv_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+func TestForwardConsole(t *testing.T) {
+	var mu sync.Mutex
+	var messages []*unisrv.ConsoleMessage
+
+	h := unisrv.NewHandler("testdata", &unisrv.Options{
+		Base: "/base/",
+		ForwardConsole: func(msg *unisrv.ConsoleMessage) {
+			mu.Lock()
+			defer mu.Unlock()
+			messages = append(messages, msg)
+		},
+	})
+
+	t.Run("injection", func(tt *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/base/", nil)
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, r)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			tt.Fatalf("read failed: %+v", err)
+		}
+		if !strings.Contains(string(b), `"/base/__unisrv/console"`) {
+			tt.Errorf("script is not injected: %q", string(b))
+		}
+	})
+
+	cases := []struct {
+		name       string
+		method     string
+		body       string
+		statusCode int
+		messages   []*unisrv.ConsoleMessage
+	}{
+		{
+			name:   "messages",
+			method: http.MethodPost,
+			body: `{"client":"abc123","messages":[` +
+				`{"level":"log","time":1700000000000,"text":"hello"},` +
+				`{"level":"error","time":1700000000500,"text":"Error: boom\n    at main.js:1:1"}]}`,
+			statusCode: http.StatusNoContent,
+			messages: []*unisrv.ConsoleMessage{
+				{
+					Client:     "abc123",
+					RemoteAddr: "192.0.2.1:1234",
+					UserAgent:  "test",
+					Level:      "log",
+					Time:       time.UnixMilli(1700000000000),
+					Text:       "hello",
+				},
+				{
+					Client:     "abc123",
+					RemoteAddr: "192.0.2.1:1234",
+					UserAgent:  "test",
+					Level:      "error",
+					Time:       time.UnixMilli(1700000000500),
+					Text:       "Error: boom\n    at main.js:1:1",
+				},
+			},
+		},
+		{
+			name:       "invalid body",
+			method:     http.MethodPost,
+			body:       "hello",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid method",
+			method:     http.MethodGet,
+			statusCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			messages = nil
+
+			r := httptest.NewRequest(v.method, "/base/__unisrv/console", strings.NewReader(v.body))
+			r.Header.Set("User-Agent", "test")
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			tt.Run("status code", func(ttt *testing.T) {
+				if resp.StatusCode != v.statusCode {
+					ttt.Errorf("expected %d, but got %d", v.statusCode, resp.StatusCode)
+				}
+			})
+
+			tt.Run("messages", func(ttt *testing.T) {
+				if len(messages) != len(v.messages) {
+					ttt.Fatalf("expected %d messages, but got %d", len(v.messages), len(messages))
+				}
+				for i, expected := range v.messages {
+					actual := messages[i]
+					if !actual.Time.Equal(expected.Time) || !sameExceptTime(actual, expected) {
+						ttt.Errorf("expected %+v, but got %+v", expected, actual)
+					}
+				}
+			})
+		})
+	}
+}
+
+// sameExceptTime reports whether the messages are the same except for the time.
+func sameExceptTime(a, b *unisrv.ConsoleMessage) bool {
+	aa, bb := *a, *b
+	aa.Time, bb.Time = time.Time{}, time.Time{}
+	return aa == bb
+}
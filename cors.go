@@ -0,0 +1,108 @@
+package unisrv
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CORSOptions describes options for Cross-Origin Resource Sharing.
+type CORSOptions struct {
+	// AllowedOrigins specifies the origins allowed to access Unity application, e.g. `https://example.com`.
+	// "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedMethods specifies the methods allowed in addition to the CORS-safelisted methods.
+	AllowedMethods []string
+	// AllowedHeaders specifies the request headers allowed in preflight requests.
+	// If it is empty or contains "*", any requested headers are allowed.
+	AllowedHeaders []string
+	// AllowCredentials specifies whether to allow requests with credentials.
+	AllowCredentials bool
+}
+
+// safelistedMethods is the list of CORS-safelisted methods.
+var safelistedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// allowOrigin returns a value of `Access-Control-Allow-Origin` header for the origin.
+// It returns an empty string if the origin is not allowed.
+func (s *CORSOptions) allowOrigin(origin string) string {
+	if slices.Contains(s.AllowedOrigins, "*") {
+		if s.AllowCredentials {
+			// The wildcard cannot be used for requests with credentials.
+			return origin
+		}
+		return "*"
+	}
+	if slices.Contains(s.AllowedOrigins, origin) {
+		return origin
+	}
+	return ""
+}
+
+// allowMethod reports whether the method is allowed.
+func (s *CORSOptions) allowMethod(method string) bool {
+	return slices.Contains(safelistedMethods, method) || slices.Contains(s.AllowedMethods, method)
+}
+
+// allowHeaders returns a value of `Access-Control-Allow-Headers` header for the requested headers.
+func (s *CORSOptions) allowHeaders(requested string) string {
+	if len(s.AllowedHeaders) == 0 || slices.Contains(s.AllowedHeaders, "*") {
+		return requested
+	}
+	return strings.Join(s.AllowedHeaders, ", ")
+}
+
+// corsMiddleware is a middleware that sets CORS headers and responds to preflight requests.
+func corsMiddleware(opts *CORSOptions, next http.Handler) http.Handler {
+	if opts == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Responses vary by the origin even for requests without it,
+		// so that shared caches do not serve them to cross-origin requests.
+		h := w.Header()
+		h.Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		allowed := opts.allowOrigin(origin)
+
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+
+			method := r.Header.Get("Access-Control-Request-Method")
+			if allowed == "" || !opts.allowMethod(method) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			setAllowOrigin(h, allowed, opts.AllowCredentials)
+			h.Set("Access-Control-Allow-Methods", method)
+			if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				h.Set("Access-Control-Allow-Headers", opts.allowHeaders(requested))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if allowed != "" {
+			setAllowOrigin(h, allowed, opts.AllowCredentials)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setAllowOrigin sets `Access-Control-Allow-Origin` and `Access-Control-Allow-Credentials` headers.
+func setAllowOrigin(h http.Header, origin string, credentials bool) {
+	h.Set("Access-Control-Allow-Origin", origin)
+	if credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,195 @@
+package unisrv_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+func TestNewHandlerCORS(t *testing.T) {
+	cases := []struct {
+		name         string
+		cors         *unisrv.CORSOptions
+		method       string
+		header       map[string]string
+		statusCode   int
+		allowOrigin  string
+		credentials  string
+		allowMethods string
+		allowHeaders string
+	}{
+		{
+			name:       "disabled",
+			cors:       nil,
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://example.com"},
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "no origin",
+			cors: &unisrv.CORSOptions{
+				AllowedOrigins: []string{"https://example.com"},
+			},
+			method:     http.MethodGet,
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "no origin with wildcard",
+			cors: &unisrv.CORSOptions{
+				AllowedOrigins: []string{"*"},
+			},
+			method:     http.MethodGet,
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "allowed origin",
+			cors: &unisrv.CORSOptions{
+				AllowedOrigins: []string{"https://example.com"},
+			},
+			method:      http.MethodGet,
+			header:      map[string]string{"Origin": "https://example.com"},
+			statusCode:  http.StatusOK,
+			allowOrigin: "https://example.com",
+		},
+		{
+			name: "disallowed origin",
+			cors: &unisrv.CORSOptions{
+				AllowedOrigins: []string{"https://example.com"},
+			},
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://example.net"},
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "wildcard",
+			cors: &unisrv.CORSOptions{
+				AllowedOrigins: []string{"*"},
+			},
+			method:      http.MethodGet,
+			header:      map[string]string{"Origin": "https://example.com"},
+			statusCode:  http.StatusOK,
+			allowOrigin: "*",
+		},
+		{
+			name: "wildcard with credentials",
+			cors: &unisrv.CORSOptions{
+				AllowedOrigins:   []string{"*"},
+				AllowCredentials: true,
+			},
+			method:      http.MethodGet,
+			header:      map[string]string{"Origin": "https://example.com"},
+			statusCode:  http.StatusOK,
+			allowOrigin: "https://example.com",
+			credentials: "true",
+		},
+		{
+			name: "preflight",
+			cors: &unisrv.CORSOptions{
+				AllowedOrigins: []string{"https://example.com"},
+			},
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "range",
+			},
+			statusCode:   http.StatusNoContent,
+			allowOrigin:  "https://example.com",
+			allowMethods: "GET",
+			allowHeaders: "range",
+		},
+		{
+			name: "preflight with allowed headers",
+			cors: &unisrv.CORSOptions{
+				AllowedOrigins: []string{"https://example.com"},
+				AllowedMethods: []string{http.MethodPut},
+				AllowedHeaders: []string{"X-Foo", "X-Bar"},
+			},
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "x-foo",
+			},
+			statusCode:   http.StatusNoContent,
+			allowOrigin:  "https://example.com",
+			allowMethods: "PUT",
+			allowHeaders: "X-Foo, X-Bar",
+		},
+		{
+			name: "preflight with disallowed method",
+			cors: &unisrv.CORSOptions{
+				AllowedOrigins: []string{"https://example.com"},
+			},
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name: "preflight with disallowed origin",
+			cors: &unisrv.CORSOptions{
+				AllowedOrigins: []string{"https://example.com"},
+			},
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                        "https://example.net",
+				"Access-Control-Request-Method": "GET",
+			},
+			statusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			h := unisrv.NewHandler("testdata", &unisrv.Options{
+				Base: "/base/",
+				CORS: v.cors,
+			})
+
+			r := httptest.NewRequest(v.method, "/base/Build/Build.data.br", nil)
+			for key, value := range v.header {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			tt.Run("status code", func(ttt *testing.T) {
+				if resp.StatusCode != v.statusCode {
+					ttt.Errorf("expected %d, but got %d", v.statusCode, resp.StatusCode)
+				}
+			})
+
+			headers := map[string]string{
+				"Access-Control-Allow-Origin":      v.allowOrigin,
+				"Access-Control-Allow-Credentials": v.credentials,
+				"Access-Control-Allow-Methods":     v.allowMethods,
+				"Access-Control-Allow-Headers":     v.allowHeaders,
+			}
+			for key, expected := range headers {
+				tt.Run(key+" header", func(ttt *testing.T) {
+					if actual := resp.Header.Get(key); actual != expected {
+						ttt.Errorf("expected %q, but got %q", expected, actual)
+					}
+				})
+			}
+
+			tt.Run("Vary header", func(ttt *testing.T) {
+				// Responses vary by the origin whenever CORS is enabled.
+				expected := v.cors != nil
+				if varyOrigin := slices.Contains(resp.Header.Values("Vary"), "Origin"); varyOrigin != expected {
+					ttt.Errorf("expected Vary to contain Origin to be %v, but got %q", expected, resp.Header.Values("Vary"))
+				}
+			})
+		})
+	}
+}
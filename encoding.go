@@ -0,0 +1,292 @@
+package unisrv
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// contentCoding describes a content coding used for precompressed Unity assets.
+type contentCoding struct {
+	// name is the token used in `Content-Encoding` and `Accept-Encoding` headers.
+	name string
+	// ext is the file extension of assets precompressed with the coding.
+	ext string
+	// newReader returns a reader that decodes r.
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+// contentCodings is the list of supported content codings in order of preference.
+var contentCodings = []*contentCoding{
+	{
+		name: "br",
+		ext:  ".br",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(brotli.NewReader(r)), nil
+		},
+	},
+	{
+		name: "zstd",
+		ext:  ".zst",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, fmt.Errorf("new zstd reader: %w", err)
+			}
+			return zr.IOReadCloser(), nil
+		},
+	},
+	{
+		name: "gzip",
+		ext:  ".gz",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, fmt.Errorf("new gzip reader: %w", err)
+			}
+			return zr, nil
+		},
+	},
+}
+
+// codingByName returns the content coding for the given `Content-Encoding` token.
+func codingByName(name string) *contentCoding {
+	for _, c := range contentCodings {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// codingByExt returns the content coding for the given file extension.
+func codingByExt(ext string) *contentCoding {
+	for _, c := range contentCodings {
+		if c.ext == ext {
+			return c
+		}
+	}
+	return nil
+}
+
+// acceptsEncoding reports whether the request accepts the given content coding.
+//
+// A request without `Accept-Encoding` header accepts any content coding.
+func acceptsEncoding(r *http.Request, coding string) bool {
+	values, ok := r.Header["Accept-Encoding"]
+	if !ok {
+		return true
+	}
+
+	wildcard := -1.0
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			name, q := parseAcceptEncodingElement(element)
+			switch {
+			case strings.EqualFold(name, coding):
+				return q > 0
+			case name == "*":
+				wildcard = q
+			}
+		}
+	}
+
+	if wildcard >= 0 {
+		return wildcard > 0
+	}
+	return coding == "identity"
+}
+
+// parseAcceptEncodingElement parses an element of `Accept-Encoding` header
+// and returns its content coding and quality value.
+func parseAcceptEncodingElement(element string) (coding string, q float64) {
+	coding, params, _ := strings.Cut(element, ";")
+	coding = strings.TrimSpace(coding)
+	q = 1
+
+	for _, param := range strings.Split(params, ";") {
+		key, value, found := strings.Cut(param, "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(key), "q") {
+			continue
+		}
+		if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			q = v
+		}
+	}
+
+	return coding, q
+}
+
+// transcodingWriter is a http.ResponseWriter that decodes precompressed response body
+// and optionally re-encodes it with gzip.
+type transcodingWriter struct {
+	http.ResponseWriter
+	src     *contentCoding
+	regzip  bool
+	active  bool
+	started bool
+	pw      *io.PipeWriter
+	done    chan error
+}
+
+// newTranscodingWriter returns a transcodingWriter that decodes src.
+// If regzip is true, the decoded body is re-encoded with gzip.
+func newTranscodingWriter(w http.ResponseWriter, src *contentCoding, regzip bool) *transcodingWriter {
+	return &transcodingWriter{
+		ResponseWriter: w,
+		src:            src,
+		regzip:         regzip,
+	}
+}
+
+// variant returns the name of the transcoded representation used for ETags.
+func (s *transcodingWriter) variant() string {
+	if s.regzip {
+		return "gzip"
+	}
+	return "identity"
+}
+
+func (s *transcodingWriter) WriteHeader(code int) {
+	if etag := s.Header().Get("ETag"); etag != "" {
+		s.Header().Set("ETag", etagVariant(etag, s.variant()))
+	}
+
+	if code == http.StatusOK {
+		s.active = true
+		h := s.Header()
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		if s.regzip {
+			h.Set("Content-Encoding", "gzip")
+		} else {
+			h.Del("Content-Encoding")
+		}
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *transcodingWriter) Write(p []byte) (int, error) {
+	if !s.active {
+		n, err := s.ResponseWriter.Write(p)
+		if err != nil {
+			return n, fmt.Errorf("write: %w", err)
+		}
+		return n, nil
+	}
+
+	if !s.started {
+		s.start()
+	}
+
+	n, err := s.pw.Write(p)
+	if err != nil {
+		return n, fmt.Errorf("transcode: %w", err)
+	}
+	return n, nil
+}
+
+// start starts decoding written body in background.
+func (s *transcodingWriter) start() {
+	s.started = true
+
+	pr, pw := io.Pipe()
+	s.pw = pw
+	s.done = make(chan error, 1)
+
+	go func() {
+		err := s.decode(pr)
+		pr.CloseWithError(err)
+		s.done <- err
+	}()
+}
+
+// decode copies decoded body read from r to the underlying writer.
+func (s *transcodingWriter) decode(r io.Reader) error {
+	dec, err := s.src.newReader(r)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+
+	var dst io.Writer = s.ResponseWriter
+	var zw *gzip.Writer
+	if s.regzip {
+		zw = gzip.NewWriter(s.ResponseWriter)
+		dst = zw
+	}
+
+	if _, err := io.Copy(dst, dec); err != nil {
+		return fmt.Errorf("decode %s: %w", s.src.name, err)
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("close gzip writer: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close flushes the remaining body and waits for decoding to finish.
+func (s *transcodingWriter) Close() error {
+	if !s.started {
+		return nil
+	}
+
+	if err := s.pw.Close(); err != nil {
+		return fmt.Errorf("close pipe: %w", err)
+	}
+	return <-s.done
+}
+
+// openDecoded opens the named file in fsys and returns a reader of the decoded content.
+// The content coding is determined by the file extension or sniffed for `.unityweb` files.
+func openDecoded(fsys fs.FS, name string) (io.ReadCloser, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+
+	br := bufio.NewReader(f)
+	coding := codingByExt(path.Ext(name))
+	if coding == nil && path.Ext(name) == unitywebExt {
+		head, _ := br.Peek(sniffLen)
+		coding = sniffCoding(head)
+	}
+	if coding == nil {
+		return readCloser{Reader: br, Closer: f}, nil
+	}
+
+	dec, err := coding.newReader(br)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return readCloser{Reader: dec, Closer: closerFunc(func() error {
+		dec.Close()
+		return f.Close()
+	})}, nil
+}
+
+// readCloser combines io.Reader and io.Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// closerFunc is an adapter to allow the use of a function as io.Closer.
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
@@ -0,0 +1,34 @@
+package unisrv
+
+import (
+	"net/http"
+	"strings"
+)
+
+// internalPathPrefix is the path prefix for endpoints provided by unisrv itself.
+const internalPathPrefix = "/__unisrv/"
+
+// internalPath returns the absolute URL path of the internal endpoint under the base path.
+func internalPath(base, name string) string {
+	return strings.TrimSuffix(base, "/") + name
+}
+
+// routeInternal is a middleware that routes requests for the internal endpoints.
+func routeInternal(endpoints map[string]http.Handler, next http.Handler) http.Handler {
+	if len(endpoints) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path
+		if !strings.HasPrefix(name, "/") {
+			// StripPrefix leaves a relative path if the base path ends with a slash.
+			name = "/" + name
+		}
+		if h, ok := endpoints[name]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
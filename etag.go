@@ -0,0 +1,135 @@
+package unisrv
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// etagHashLen is the number of bytes of the content hash used for ETags.
+const etagHashLen = 16
+
+// contentETags is a middleware that sets a strong `ETag` header computed from the content of the requested file.
+// http.FileServer uses it to evaluate `If-None-Match` and `If-Range` headers.
+//
+// Unlike `Last-Modified`, ETags stay the same when the build is copied to another machine.
+// They are cached by name, modification time and size so that each file is hashed only once.
+func contentETags(root http.FileSystem, next http.Handler) http.Handler {
+	cache := &etagCache{
+		entries: make(map[string]etagEntry),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			if etag, ok := cache.etag(root, r.URL.Path); ok {
+				w.Header().Set("ETag", etag)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// etagCache caches ETags of files.
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]etagEntry
+}
+
+// etagEntry is a cached ETag with the file state it is computed for.
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// etag returns the ETag of the file served for the request path.
+// It reports false if the path is not served as a file.
+func (s *etagCache) etag(root http.FileSystem, name string) (string, bool) {
+	dir := name == "" || strings.HasSuffix(name, "/")
+	// http.StripPrefix leaves a relative path under the base path.
+	name = path.Clean("/" + name)
+	if !dir && strings.HasSuffix(name, "/index.html") {
+		// http.FileServer redirects it to the directory.
+		return "", false
+	}
+	if dir {
+		name = path.Join(name, "index.html")
+	}
+
+	f, err := root.Open(name)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	s.mu.Unlock()
+	if ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+		return e.etag, true
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", false
+	}
+	etag := fmt.Sprintf("%q", base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:etagHashLen]))
+
+	s.mu.Lock()
+	s.entries[name] = etagEntry{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		etag:    etag,
+	}
+	s.mu.Unlock()
+
+	return etag, true
+}
+
+// etagVariant returns the strong ETag of the representation derived from the one with etag,
+// e.g. `"abc-gzip"` for `"abc"`.
+// Weak ETags are returned as is.
+func etagVariant(etag, variant string) string {
+	if !isStrongETag(etag) {
+		return etag
+	}
+	return etag[:len(etag)-1] + "-" + variant + `"`
+}
+
+// trimETagVariant converts ETags of the variant in the `If-None-Match` header of the request
+// to ETags of the original representation so that they can be compared with the file.
+// It returns the request as is if there is nothing to convert.
+func trimETagVariant(r *http.Request, variant string) *http.Request {
+	inm := r.Header.Get("If-None-Match")
+	suffix := "-" + variant + `"`
+	if !strings.Contains(inm, suffix) {
+		return r
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set("If-None-Match", strings.ReplaceAll(inm, suffix, `"`))
+	return r
+}
+
+// weakenETag makes the `ETag` header weak.
+func weakenETag(h http.Header) {
+	if etag := h.Get("ETag"); isStrongETag(etag) {
+		h.Set("ETag", "W/"+etag)
+	}
+}
+
+// isStrongETag reports whether etag is a strong ETag.
+func isStrongETag(etag string) bool {
+	return len(etag) >= 2 && etag[0] == '"' && etag[len(etag)-1] == '"'
+}
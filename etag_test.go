@@ -0,0 +1,212 @@
+package unisrv_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+func TestNewHandlerETag(t *testing.T) {
+	serve := func(h http.Handler, path string, header map[string]string) *http.Response {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, value := range header {
+			r.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	h := unisrv.NewHandler("testdata", &unisrv.Options{ETag: true})
+
+	t.Run("disabled", func(tt *testing.T) {
+		resp := serve(unisrv.NewHandler("testdata", nil), "/Build/Build.wasm.br", nil)
+		defer resp.Body.Close()
+
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			tt.Errorf("expected no ETag, but got %q", etag)
+		}
+	})
+
+	t.Run("same content", func(tt *testing.T) {
+		newFS := func(modTime time.Time) fstest.MapFS {
+			return fstest.MapFS{
+				"Build/Build.data": {Data: []byte("data"), ModTime: modTime},
+			}
+		}
+
+		h1 := unisrv.NewHandlerFS(newFS(time.Unix(1, 0)), &unisrv.Options{ETag: true})
+		h2 := unisrv.NewHandlerFS(newFS(time.Unix(2, 0)), &unisrv.Options{ETag: true})
+
+		resp1 := serve(h1, "/Build/Build.data", nil)
+		defer resp1.Body.Close()
+		resp2 := serve(h2, "/Build/Build.data", nil)
+		defer resp2.Body.Close()
+
+		etag1, etag2 := resp1.Header.Get("ETag"), resp2.Header.Get("ETag")
+		if etag1 == "" || etag1 != etag2 {
+			tt.Errorf("expected the same ETags, but got %q and %q", etag1, etag2)
+		}
+	})
+
+	t.Run("redirect", func(tt *testing.T) {
+		cases := []struct {
+			name string
+			base string
+			path string
+		}{
+			{name: "root", base: "/", path: "/index.html"},
+			{name: "base path", base: "/base/", path: "/base/index.html"},
+		}
+
+		for _, v := range cases {
+			tt.Run(v.name, func(ttt *testing.T) {
+				h := unisrv.NewHandler("testdata", &unisrv.Options{ETag: true, Base: v.base})
+				resp := serve(h, v.path, nil)
+				defer resp.Body.Close()
+
+				if resp.StatusCode != http.StatusMovedPermanently {
+					ttt.Errorf("expected %d, but got %d", http.StatusMovedPermanently, resp.StatusCode)
+				}
+				if etag := resp.Header.Get("ETag"); etag != "" {
+					ttt.Errorf("expected no ETag, but got %q", etag)
+				}
+			})
+		}
+	})
+
+	cases := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		variant        string
+	}{
+		{
+			name:           "file",
+			path:           "/Build/Build.wasm.br",
+			acceptEncoding: "br",
+			variant:        "",
+		},
+		{
+			name:           "index",
+			path:           "/",
+			acceptEncoding: "br",
+			variant:        "",
+		},
+		{
+			name:           "precompressed sibling",
+			path:           "/Build/Build.wasm",
+			acceptEncoding: "gzip",
+			variant:        "",
+		},
+		{
+			name:           "decoded",
+			path:           "/Build/Build.wasm.br",
+			acceptEncoding: "identity",
+			variant:        "-identity",
+		},
+		{
+			name:           "re-encoded with gzip",
+			path:           "/Build/Build.data.br",
+			acceptEncoding: "gzip",
+			variant:        "-gzip",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			resp := serve(h, v.path, map[string]string{"Accept-Encoding": v.acceptEncoding})
+			defer resp.Body.Close()
+
+			etag := resp.Header.Get("ETag")
+			tt.Run("ETag header", func(ttt *testing.T) {
+				if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, v.variant+`"`) {
+					ttt.Errorf("expected strong ETag with %q suffix, but got %q", v.variant, etag)
+				}
+			})
+
+			tt.Run("If-None-Match", func(ttt *testing.T) {
+				resp := serve(h, v.path, map[string]string{
+					"Accept-Encoding": v.acceptEncoding,
+					"If-None-Match":   etag,
+				})
+				defer resp.Body.Close()
+
+				if resp.StatusCode != http.StatusNotModified {
+					ttt.Errorf("expected %d, but got %d", http.StatusNotModified, resp.StatusCode)
+				}
+				if actual := resp.Header.Get("ETag"); actual != etag {
+					ttt.Errorf("expected %q, but got %q", etag, actual)
+				}
+			})
+
+			tt.Run("If-None-Match mismatch", func(ttt *testing.T) {
+				resp := serve(h, v.path, map[string]string{
+					"Accept-Encoding": v.acceptEncoding,
+					"If-None-Match":   `"mismatch"`,
+				})
+				defer resp.Body.Close()
+
+				if resp.StatusCode != http.StatusOK {
+					ttt.Errorf("expected %d, but got %d", http.StatusOK, resp.StatusCode)
+				}
+			})
+		})
+	}
+
+	t.Run("If-Range", func(tt *testing.T) {
+		resp := serve(h, "/Build/Build.wasm.br", map[string]string{"Accept-Encoding": "br"})
+		defer resp.Body.Close()
+		etag := resp.Header.Get("ETag")
+
+		rangeCases := []struct {
+			name       string
+			ifRange    string
+			statusCode int
+		}{
+			{
+				name:       "match",
+				ifRange:    etag,
+				statusCode: http.StatusPartialContent,
+			},
+			{
+				name:       "mismatch",
+				ifRange:    `"mismatch"`,
+				statusCode: http.StatusOK,
+			},
+		}
+
+		for _, vv := range rangeCases {
+			tt.Run(vv.name, func(ttt *testing.T) {
+				resp := serve(h, "/Build/Build.wasm.br", map[string]string{
+					"Accept-Encoding": "br",
+					"Range":           "bytes=0-1",
+					"If-Range":        vv.ifRange,
+				})
+				defer resp.Body.Close()
+
+				if resp.StatusCode != vv.statusCode {
+					ttt.Errorf("expected %d, but got %d", vv.statusCode, resp.StatusCode)
+				}
+			})
+		}
+	})
+
+	t.Run("injected", func(tt *testing.T) {
+		liveReload := unisrv.NewLiveReload()
+		defer liveReload.Close()
+
+		h := unisrv.NewHandler("testdata", &unisrv.Options{ETag: true, LiveReload: liveReload})
+		resp := serve(h, "/", nil)
+		defer resp.Body.Close()
+
+		if etag := resp.Header.Get("ETag"); !strings.HasPrefix(etag, `W/"`) {
+			tt.Errorf("expected weak ETag, but got %q", etag)
+		}
+	})
+}
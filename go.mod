@@ -3,3 +3,10 @@ module github.com/frozenbonito/unisrv
 go 1.22
 
 toolchain go1.24.0
+
+require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/klauspost/compress v1.18.0
+	github.com/pelletier/go-toml/v2 v2.2.4
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+)
@@ -0,0 +1,84 @@
+package localca_test
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/frozenbonito/unisrv/internal/localca"
+)
+
+func TestLoadOrCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "unisrv")
+
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	cert, err := localca.LoadOrCreate(dir, hosts)
+	if err != nil {
+		t.Fatalf("create failed: %+v", err)
+	}
+
+	caPEM, err := os.ReadFile(filepath.Join(dir, localca.CACertFile))
+	if err != nil {
+		t.Fatalf("read CA failed: %+v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		t.Fatalf("invalid CA certificate")
+	}
+
+	verify := func(t *testing.T, der []byte, hosts []string) {
+		leaf, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("parse failed: %+v", err)
+		}
+		for _, host := range hosts {
+			if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+				t.Errorf("verify %s failed: %+v", host, err)
+			}
+		}
+	}
+
+	t.Run("created", func(tt *testing.T) {
+		verify(tt, cert.Certificate[0], hosts)
+
+		info, err := os.Stat(filepath.Join(dir, localca.CAKeyFile))
+		if err != nil {
+			tt.Fatalf("stat failed: %+v", err)
+		}
+		if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm != 0o600 {
+			tt.Errorf("expected %o, but got %o", 0o600, perm)
+		}
+	})
+
+	t.Run("reused", func(tt *testing.T) {
+		reused, err := localca.LoadOrCreate(dir, []string{"localhost"})
+		if err != nil {
+			tt.Fatalf("load failed: %+v", err)
+		}
+		if string(reused.Certificate[0]) != string(cert.Certificate[0]) {
+			tt.Errorf("expected the certificate to be reused")
+		}
+	})
+
+	t.Run("hosts changed", func(tt *testing.T) {
+		newHosts := []string{"localhost", "192.168.0.10"}
+		renewed, err := localca.LoadOrCreate(dir, newHosts)
+		if err != nil {
+			tt.Fatalf("load failed: %+v", err)
+		}
+		if string(renewed.Certificate[0]) == string(cert.Certificate[0]) {
+			tt.Errorf("expected the certificate to be renewed")
+		}
+		verify(tt, renewed.Certificate[0], newHosts)
+
+		caPEM2, err := os.ReadFile(filepath.Join(dir, localca.CACertFile))
+		if err != nil {
+			tt.Fatalf("read CA failed: %+v", err)
+		}
+		if string(caPEM2) != string(caPEM) {
+			tt.Errorf("expected the CA to be reused")
+		}
+	})
+}
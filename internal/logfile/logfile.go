@@ -0,0 +1,169 @@
+// Package logfile provides a log file writer rotated by size or time.
+//
+// Rotated files are renamed with the time of the rotation appended, e.g. `access.log.20060102-150405.000`.
+// The file can also be reopened after it is moved by external tools such as logrotate.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the layout of the time appended to rotated files.
+const backupTimeFormat = "20060102-150405.000"
+
+const (
+	dirPerm  = 0o755
+	filePerm = 0o644
+)
+
+// Options describes options for rotation.
+type Options struct {
+	// MaxSize is the size in bytes to rotate the file at. Zero disables size-based rotation.
+	MaxSize int64
+	// Interval is the interval to rotate the file at. Zero disables time-based rotation.
+	Interval time.Duration
+}
+
+// File is an io.Writer writing to the log file. It is safe for concurrent use.
+type File struct {
+	name string
+	opts Options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// Open opens the log file for appending, creating it and its directory if necessary.
+func Open(name string, opts Options) (*File, error) {
+	f := &File{
+		name: name,
+		opts: opts,
+		now:  time.Now,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Write writes p to the log file, rotating it before writing if necessary.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("write %s: %w", f.name, err)
+	}
+
+	return n, nil
+}
+
+// Rotate renames the log file with the current time appended and opens a new one.
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.rotate()
+}
+
+// Reopen closes and reopens the log file.
+// It is used to write to a new file after the log file is moved by external tools.
+func (f *File) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.close(); err != nil {
+		return err
+	}
+
+	return f.open()
+}
+
+// Close closes the log file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.close()
+}
+
+func (f *File) shouldRotate(n int64) bool {
+	if f.opts.MaxSize > 0 && f.size > 0 && f.size+n > f.opts.MaxSize {
+		return true
+	}
+	if f.opts.Interval > 0 && f.now().Sub(f.openedAt) >= f.opts.Interval {
+		return true
+	}
+	return false
+}
+
+func (f *File) rotate() error {
+	if err := f.close(); err != nil {
+		return err
+	}
+
+	backup := f.name + "." + f.now().Format(backupTimeFormat)
+	if err := os.Rename(f.name, backup); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rotate %s: %w", f.name, err)
+	}
+
+	return f.open()
+}
+
+func (f *File) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.name), dirPerm); err != nil {
+		return fmt.Errorf("create directory of %s: %w", f.name, err)
+	}
+
+	file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, filePerm)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", f.name, err)
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close() //nolint:errcheck
+		return fmt.Errorf("stat %s: %w", f.name, err)
+	}
+
+	f.file = file
+	f.size = fi.Size()
+	f.openedAt = f.now()
+
+	return nil
+}
+
+func (f *File) close() error {
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return fmt.Errorf("close %s: %w", f.name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package logfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/frozenbonito/unisrv/internal/logfile"
+)
+
+func TestFile(t *testing.T) {
+	readFiles := func(t *testing.T, dir string) []string {
+		t.Helper()
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("read dir failed: %+v", err)
+		}
+
+		var contents []string
+		for _, e := range entries {
+			b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+			if err != nil {
+				t.Fatalf("read failed: %+v", err)
+			}
+			contents = append(contents, string(b))
+		}
+		slices.Sort(contents)
+		return contents
+	}
+
+	cases := []struct {
+		name     string
+		opts     logfile.Options
+		wait     time.Duration
+		expected []string
+	}{
+		{
+			name:     "no rotation",
+			expected: []string{"line1\nline2\nline3\n"},
+		},
+		{
+			name:     "size",
+			opts:     logfile.Options{MaxSize: 12},
+			expected: []string{"line1\nline2\n", "line3\n"},
+		},
+		{
+			name:     "interval",
+			opts:     logfile.Options{Interval: 10 * time.Millisecond},
+			wait:     20 * time.Millisecond,
+			expected: []string{"line1\n", "line2\n", "line3\n"},
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			dir := filepath.Join(tt.TempDir(), "logs")
+
+			f, err := logfile.Open(filepath.Join(dir, "access.log"), v.opts)
+			if err != nil {
+				tt.Fatalf("open failed: %+v", err)
+			}
+			defer f.Close()
+
+			for _, line := range []string{"line1\n", "line2\n", "line3\n"} {
+				if _, err := f.Write([]byte(line)); err != nil {
+					tt.Fatalf("write failed: %+v", err)
+				}
+				time.Sleep(v.wait)
+			}
+
+			if actual := readFiles(tt, dir); !slices.Equal(actual, v.expected) {
+				tt.Errorf("expected %q, but got %q", v.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "access.log")
+
+	f, err := logfile.Open(name, logfile.Options{})
+	if err != nil {
+		t.Fatalf("open failed: %+v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte("before\n")); err != nil {
+		t.Fatalf("write failed: %+v", err)
+	}
+
+	// Close the file before renaming it because Windows does not allow renaming open files.
+	if err := f.Close(); err != nil {
+		t.Fatalf("close failed: %+v", err)
+	}
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatalf("rename failed: %+v", err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("reopen failed: %+v", err)
+	}
+
+	if _, err := f.Write([]byte("after\n")); err != nil {
+		t.Fatalf("write failed: %+v", err)
+	}
+
+	for file, expected := range map[string]string{name + ".1": "before\n", name: "after\n"} {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read failed: %+v", err)
+		}
+		if actual := string(b); actual != expected {
+			t.Errorf("expected %q, but got %q", expected, actual)
+		}
+	}
+}
+
+func TestFileClosed(t *testing.T) {
+	f, err := logfile.Open(filepath.Join(t.TempDir(), "access.log"), logfile.Options{})
+	if err != nil {
+		t.Fatalf("open failed: %+v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("close failed: %+v", err)
+	}
+
+	if _, err := f.Write([]byte("line\n")); err == nil {
+		t.Errorf("unexpected success")
+	}
+}
@@ -0,0 +1,308 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/frozenbonito/unisrv/internal/pathpattern"
+)
+
+// defaultTruncateRatio is the ratio of the body written before truncation if it is not specified.
+const defaultTruncateRatio = 0.5
+
+// randFloat returns a pseudo-random number in [0.0, 1.0). It is replaced in tests.
+var randFloat = rand.Float64
+
+// errTruncated is returned by writes after the body has been truncated.
+var errTruncated = errors.New("truncated by fault injection")
+
+// FaultAction describes a fault to inject.
+// Exactly one of the fields is set.
+type FaultAction struct {
+	// Status is the error status code to respond with.
+	Status int
+	// Stall is the duration to delay the response.
+	Stall time.Duration
+	// Truncate is the ratio of the body written before the connection is aborted.
+	Truncate float64
+	// Reset specifies whether to reset the connection without responding.
+	Reset bool
+}
+
+// ParseFaultAction parses the fault action:
+// a 5xx status code, `stall:DURATION`, `truncate[:PERCENT%]` or `reset`.
+func ParseFaultAction(s string) (FaultAction, error) {
+	name, arg, hasArg := strings.Cut(s, ":")
+	switch {
+	case name == "reset" && !hasArg:
+		return FaultAction{Reset: true}, nil
+	case name == "stall" && hasArg:
+		d, err := time.ParseDuration(arg)
+		if err != nil || d <= 0 {
+			return FaultAction{}, fmt.Errorf("invalid stall duration %q", arg)
+		}
+		return FaultAction{Stall: d}, nil
+	case name == "truncate" && !hasArg:
+		return FaultAction{Truncate: defaultTruncateRatio}, nil
+	case name == "truncate":
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(arg, "%"), 64)
+		// A zero ratio would not be distinguished from the other actions.
+		if err != nil || percent <= 0 || percent >= 100 {
+			return FaultAction{}, fmt.Errorf("invalid truncate percentage %q", arg)
+		}
+		return FaultAction{Truncate: percent / 100}, nil //nolint:mnd
+	default:
+		code, err := strconv.Atoi(s)
+		if err != nil || code < 500 || code > 599 {
+			return FaultAction{}, fmt.Errorf(
+				"invalid fault action %q: must be a 5xx status code, stall:DURATION, truncate[:PERCENT%%] or reset", s)
+		}
+		return FaultAction{Status: code}, nil
+	}
+}
+
+// String returns the fault action in the form parsed by ParseFaultAction.
+func (a FaultAction) String() string {
+	switch {
+	case a.Reset:
+		return "reset"
+	case a.Stall > 0:
+		return "stall:" + a.Stall.String()
+	case a.Truncate > 0:
+		return fmt.Sprintf("truncate:%g%%", a.Truncate*100) //nolint:mnd
+	default:
+		return strconv.Itoa(a.Status)
+	}
+}
+
+// FaultRule injects the fault into requests for paths matching the pattern with the probability.
+type FaultRule struct {
+	Pattern     *pathpattern.Pattern
+	Action      FaultAction
+	Probability float64
+}
+
+// ParseFaultRule parses the fault rule in the form of `PATTERN=ACTION[@PROBABILITY]`.
+// The probability is between 0 and 1 and defaults to 1.
+func ParseFaultRule(s string) (FaultRule, error) {
+	pattern, action, ok := strings.Cut(s, "=")
+	if !ok {
+		return FaultRule{}, fmt.Errorf("invalid fault rule %q: must be PATTERN=ACTION[@PROBABILITY]", s)
+	}
+
+	compiled, err := pathpattern.Compile(strings.TrimSpace(pattern))
+	if err != nil {
+		return FaultRule{}, fmt.Errorf("invalid fault rule: %w", err)
+	}
+
+	rule := FaultRule{
+		Pattern:     compiled,
+		Probability: 1,
+	}
+
+	action, probability, ok := strings.Cut(strings.TrimSpace(action), "@")
+	action = strings.TrimSpace(action)
+	if ok {
+		probability = strings.TrimSpace(probability)
+		rule.Probability, err = strconv.ParseFloat(probability, 64)
+		if err != nil || rule.Probability < 0 || rule.Probability > 1 {
+			return FaultRule{}, fmt.Errorf("invalid fault rule: invalid probability %q", probability)
+		}
+	}
+
+	rule.Action, err = ParseFaultAction(action)
+	if err != nil {
+		return FaultRule{}, fmt.Errorf("invalid fault rule: %w", err)
+	}
+
+	return rule, nil
+}
+
+// Faults is a set of fault rules which can be enabled and disabled at runtime.
+type Faults struct {
+	base    string
+	rules   []FaultRule
+	enabled atomic.Bool
+}
+
+// NewFaults returns new enabled Faults.
+// Patterns of the rules are matched against paths relative to base.
+func NewFaults(base string, rules []FaultRule) *Faults {
+	f := &Faults{
+		base:  base,
+		rules: rules,
+	}
+	f.enabled.Store(true)
+	return f
+}
+
+// Enabled reports whether the faults are injected.
+func (s *Faults) Enabled() bool {
+	return s.enabled.Load()
+}
+
+// SetEnabled enables or disables the faults.
+func (s *Faults) SetEnabled(enabled bool) {
+	s.enabled.Store(enabled)
+}
+
+// ServeHTTP shows whether the faults are enabled.
+// POST requests toggle it, or set it to the value of `enabled` query parameter.
+func (s *Faults) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		enabled := !s.Enabled()
+		if v := r.URL.Query().Get("enabled"); v != "" {
+			var err error
+			enabled, err = strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid enabled parameter %q", v), http.StatusBadRequest)
+				return
+			}
+		}
+		s.SetEnabled(enabled)
+		logger.Printf("fault injection enabled: %t", enabled)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, "enabled: %t\n", s.Enabled())
+}
+
+// action returns the fault action to inject into the request.
+// It reports false if no fault should be injected.
+func (s *Faults) action(r *http.Request) (FaultAction, bool) {
+	if !s.Enabled() {
+		return FaultAction{}, false
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(s.base, "/"))
+	for _, rule := range s.rules {
+		if rule.Pattern.Match(name) {
+			return rule.Action, randFloat() < rule.Probability
+		}
+	}
+	return FaultAction{}, false
+}
+
+// InjectFaults is a middleware that injects the faults into responses.
+func InjectFaults(faults *Faults, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action, ok := faults.action(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logger.Printf(`fault: "%s %s %s" - %s`, r.Method, r.RequestURI, r.Proto, action)
+
+		switch {
+		case action.Reset:
+			resetConnection(w)
+		case action.Stall > 0:
+			// The stalled response takes longer than the write timeout of the server.
+			http.NewResponseController(w).SetWriteDeadline(time.Time{}) //nolint:errcheck
+			if err := sleep(r.Context(), action.Stall); err != nil {
+				return
+			}
+			next.ServeHTTP(w, r)
+		case action.Truncate > 0:
+			tw := &truncatingWriter{ResponseWriter: w, ratio: action.Truncate}
+			next.ServeHTTP(tw, r)
+			if tw.truncated {
+				http.NewResponseController(w).Flush() //nolint:errcheck
+				// Abort the response so that the client receives an incomplete body.
+				panic(http.ErrAbortHandler)
+			}
+		default:
+			http.Error(w, http.StatusText(action.Status), action.Status)
+		}
+	})
+}
+
+// resetConnection closes the underlying connection immediately.
+// TCP connections are reset instead of closed gracefully.
+func resetConnection(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		// The connection cannot be hijacked, e.g. HTTP/2. Abort the stream instead.
+		panic(http.ErrAbortHandler)
+	}
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0) //nolint:errcheck
+	}
+	conn.Close()
+}
+
+// truncatingWriter is a http.ResponseWriter that stops writing the body after the ratio of it.
+type truncatingWriter struct {
+	http.ResponseWriter
+	ratio       float64
+	wroteHeader bool
+	limit       int64
+	written     int64
+	truncated   bool
+}
+
+func (s *truncatingWriter) WriteHeader(code int) {
+	if s.wroteHeader {
+		return
+	}
+	s.wroteHeader = true
+
+	s.limit = -1
+	if n, err := strconv.ParseInt(s.Header().Get("Content-Length"), 10, 64); err == nil {
+		s.limit = int64(float64(n) * s.ratio)
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *truncatingWriter) Write(p []byte) (int, error) {
+	if !s.wroteHeader {
+		s.WriteHeader(http.StatusOK)
+	}
+	if s.truncated {
+		return 0, errTruncated
+	}
+
+	if s.limit < 0 {
+		// The length is unknown. Truncate the first write.
+		s.limit = int64(float64(len(p)) * s.ratio)
+	}
+
+	rest := s.limit - s.written
+	if int64(len(p)) <= rest {
+		n, err := s.ResponseWriter.Write(p)
+		s.written += int64(n)
+		if err != nil {
+			return n, fmt.Errorf("write: %w", err)
+		}
+		return n, nil
+	}
+
+	s.truncated = true
+	n, err := s.ResponseWriter.Write(p[:rest])
+	s.written += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("write: %w", err)
+	}
+	return n, errTruncated
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (s *truncatingWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,322 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFaultRule(t *testing.T) {
+	cases := []struct {
+		input       string
+		pattern     string
+		action      FaultAction
+		probability float64
+		err         string
+	}{
+		{
+			input:       "*.data.br=503",
+			pattern:     "*.data.br",
+			action:      FaultAction{Status: 503},
+			probability: 1,
+		},
+		{
+			input:       "Build/**=stall:10s@0.25",
+			pattern:     "Build/**",
+			action:      FaultAction{Stall: 10 * time.Second},
+			probability: 0.25,
+		},
+		{
+			input:       "*.wasm=truncate",
+			pattern:     "*.wasm",
+			action:      FaultAction{Truncate: 0.5},
+			probability: 1,
+		},
+		{
+			input:       "*.wasm=truncate:90%",
+			pattern:     "*.wasm",
+			action:      FaultAction{Truncate: 0.9},
+			probability: 1,
+		},
+		{
+			input:       "** = reset @ 0.1",
+			pattern:     "**",
+			action:      FaultAction{Reset: true},
+			probability: 0.1,
+		},
+		{
+			input: "*.wasm",
+			err:   `invalid fault rule "*.wasm": must be PATTERN=ACTION[@PROBABILITY]`,
+		},
+		{
+			input: "*.wasm=404",
+			err: `invalid fault rule: invalid fault action "404": ` +
+				`must be a 5xx status code, stall:DURATION, truncate[:PERCENT%] or reset`,
+		},
+		{
+			input: "*.wasm=stall:forever",
+			err:   `invalid fault rule: invalid stall duration "forever"`,
+		},
+		{
+			input: "*.wasm=truncate:0%",
+			err:   `invalid fault rule: invalid truncate percentage "0%"`,
+		},
+		{
+			input: "*.wasm=truncate:100%",
+			err:   `invalid fault rule: invalid truncate percentage "100%"`,
+		},
+		{
+			input: "*.wasm=500@2",
+			err:   `invalid fault rule: invalid probability "2"`,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.input, func(tt *testing.T) {
+			rule, err := ParseFaultRule(v.input)
+			switch {
+			case err != nil && err.Error() != v.err:
+				tt.Fatalf("expected %q, but got %q", v.err, err.Error())
+			case err == nil && v.err != "":
+				tt.Fatalf("unexpected success")
+			case err != nil:
+				return
+			default:
+				// nop
+			}
+
+			if rule.Pattern.String() != v.pattern {
+				tt.Errorf("expected %q, but got %q", v.pattern, rule.Pattern.String())
+			}
+			if rule.Action != v.action {
+				tt.Errorf("expected %+v, but got %+v", v.action, rule.Action)
+			}
+			if rule.Probability != v.probability {
+				tt.Errorf("expected %v, but got %v", v.probability, rule.Probability)
+			}
+		})
+	}
+}
+
+func TestInjectFaults(t *testing.T) {
+	original := logger
+	logger = log.New(io.Discard, "", 0)
+	defer func() {
+		logger = original
+	}()
+
+	body := strings.Repeat("a", 1000)
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		io.WriteString(w, body) //nolint:errcheck
+	})
+
+	parse := func(s string) FaultRule {
+		rule, err := ParseFaultRule(s)
+		if err != nil {
+			t.Fatalf("parse failed: %+v", err)
+		}
+		return rule
+	}
+
+	faults := NewFaults("/base/", []FaultRule{
+		parse("*.data=503"),
+		parse("*.wasm=truncate:10%"),
+		parse("*.js=stall:100ms"),
+		parse("*.json=500@0.5"),
+	})
+	h := InjectFaults(faults, next)
+
+	originalRand := randFloat
+	defer func() {
+		randFloat = originalRand
+	}()
+
+	cases := []struct {
+		name       string
+		path       string
+		random     float64
+		statusCode int
+		bodyLen    int
+		aborted    bool
+		minElapsed time.Duration
+	}{
+		{
+			name:       "no fault",
+			path:       "/base/index.html",
+			statusCode: http.StatusOK,
+			bodyLen:    len(body),
+		},
+		{
+			name:       "status",
+			path:       "/base/Build/Build.data",
+			statusCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "truncate",
+			path:       "/base/Build/Build.wasm",
+			statusCode: http.StatusOK,
+			bodyLen:    100,
+			aborted:    true,
+		},
+		{
+			name:       "stall",
+			path:       "/base/Build/Build.framework.js",
+			statusCode: http.StatusOK,
+			bodyLen:    len(body),
+			minElapsed: 100 * time.Millisecond,
+		},
+		{
+			name:       "probability hit",
+			path:       "/base/Build/Build.symbols.json",
+			random:     0.4,
+			statusCode: http.StatusInternalServerError,
+		},
+		{
+			name:       "probability miss",
+			path:       "/base/Build/Build.symbols.json",
+			random:     0.6,
+			statusCode: http.StatusOK,
+			bodyLen:    len(body),
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			randFloat = func() float64 { return v.random }
+
+			r := httptest.NewRequest(http.MethodGet, v.path, nil)
+			w := httptest.NewRecorder()
+
+			aborted := false
+			start := time.Now()
+			func() {
+				defer func() {
+					if p := recover(); p != nil {
+						if !errors.Is(p.(error), http.ErrAbortHandler) { //nolint:forcetypeassert
+							panic(p)
+						}
+						aborted = true
+					}
+				}()
+				h.ServeHTTP(w, r)
+			}()
+			elapsed := time.Since(start)
+
+			if w.Code != v.statusCode {
+				tt.Errorf("expected %d, but got %d", v.statusCode, w.Code)
+			}
+			if v.bodyLen > 0 && w.Body.Len() != v.bodyLen {
+				tt.Errorf("expected %d bytes, but got %d bytes", v.bodyLen, w.Body.Len())
+			}
+			if aborted != v.aborted {
+				tt.Errorf("expected aborted to be %t, but got %t", v.aborted, aborted)
+			}
+			if elapsed < v.minElapsed {
+				tt.Errorf("expected to take %v at least, but got %v", v.minElapsed, elapsed)
+			}
+		})
+	}
+
+	t.Run("reset", func(tt *testing.T) {
+		faults := NewFaults("/", []FaultRule{parse("**=reset")})
+		srv := httptest.NewServer(InjectFaults(faults, next))
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL + "/index.html")
+		if err == nil {
+			resp.Body.Close()
+			tt.Errorf("expected connection error, but got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("disabled", func(tt *testing.T) {
+		faults.SetEnabled(false)
+		defer faults.SetEnabled(true)
+
+		r := httptest.NewRequest(http.MethodGet, "/base/Build/Build.data", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			tt.Errorf("expected %d, but got %d", http.StatusOK, w.Code)
+		}
+	})
+}
+
+func TestFaultsServeHTTP(t *testing.T) {
+	original := logger
+	logger = log.New(io.Discard, "", 0)
+	defer func() {
+		logger = original
+	}()
+
+	faults := NewFaults("/", nil)
+
+	cases := []struct {
+		name       string
+		method     string
+		target     string
+		statusCode int
+		body       string
+	}{
+		{
+			name:       "show",
+			method:     http.MethodGet,
+			target:     "/",
+			statusCode: http.StatusOK,
+			body:       "enabled: true\n",
+		},
+		{
+			name:       "toggle",
+			method:     http.MethodPost,
+			target:     "/",
+			statusCode: http.StatusOK,
+			body:       "enabled: false\n",
+		},
+		{
+			name:       "set",
+			method:     http.MethodPost,
+			target:     "/?enabled=false",
+			statusCode: http.StatusOK,
+			body:       "enabled: false\n",
+		},
+		{
+			name:       "invalid value",
+			method:     http.MethodPost,
+			target:     "/?enabled=maybe",
+			statusCode: http.StatusBadRequest,
+			body:       "invalid enabled parameter \"maybe\"\n",
+		},
+		{
+			name:       "invalid method",
+			method:     http.MethodDelete,
+			target:     "/",
+			statusCode: http.StatusMethodNotAllowed,
+			body:       "Method Not Allowed\n",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			r := httptest.NewRequest(v.method, v.target, nil)
+			w := httptest.NewRecorder()
+
+			faults.ServeHTTP(w, r)
+
+			if w.Code != v.statusCode {
+				tt.Errorf("expected %d, but got %d", v.statusCode, w.Code)
+			}
+			if !bytes.Equal(w.Body.Bytes(), []byte(v.body)) {
+				tt.Errorf("expected %q, but got %q", v.body, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+// metricsContentType is the content type of the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// durationBuckets are the upper bounds in seconds of the buckets of the request duration histogram.
+// They cover large assets downloaded over throttled connections.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricLabels are the labels of a series of the metrics.
+type metricLabels struct {
+	status   int
+	encoding string
+	asset    unisrv.AssetKind
+}
+
+func (l metricLabels) String() string {
+	return fmt.Sprintf(`asset="%s",encoding="%s",status="%d"`,
+		labelValueEscaper.Replace(string(l.asset)), labelValueEscaper.Replace(l.encoding), l.status)
+}
+
+func compareMetricLabels(a, b metricLabels) int {
+	return cmp.Or(
+		cmp.Compare(a.asset, b.asset),
+		cmp.Compare(a.encoding, b.encoding),
+		cmp.Compare(a.status, b.status),
+	)
+}
+
+// metricSeries holds the values of the metrics for the labels.
+type metricSeries struct {
+	requests uint64
+	bytes    int64
+	// buckets are the counts of requests per duration bucket, which are not cumulative.
+	buckets  []uint64
+	duration float64
+}
+
+// Metrics collects request counts, durations and bytes served,
+// labeled by status, Content-Encoding and Unity asset kind.
+// It serves them in the Prometheus text exposition format.
+type Metrics struct {
+	mu     sync.Mutex
+	series map[metricLabels]*metricSeries
+}
+
+// NewMetrics returns a new Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		series: map[metricLabels]*metricSeries{},
+	}
+}
+
+// CollectMetrics is a middleware that records metrics of each request to m.
+// Inside RequestLogger, it shares the response writer wrapper of RequestLogger.
+func CollectMetrics(m *Metrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		rw := wrapResponseWriter(w)
+		defer func() {
+			encoding := w.Header().Get("Content-Encoding")
+			if encoding == "" {
+				encoding = "identity"
+			}
+			m.observe(metricLabels{
+				status:   rw.StatusCode(),
+				encoding: encoding,
+				asset:    unisrv.AssetKindOf(r.URL.Path),
+			}, time.Since(start), rw.BytesWritten())
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func (m *Metrics) observe(labels metricLabels, duration time.Duration, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.series[labels]
+	if !ok {
+		s = &metricSeries{buckets: make([]uint64, len(durationBuckets))}
+		m.series[labels] = s
+	}
+
+	s.requests++
+	s.bytes += bytes
+	s.duration += duration.Seconds()
+	if i, _ := slices.BinarySearch(durationBuckets, duration.Seconds()); i < len(durationBuckets) {
+		s.buckets[i]++
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", metricsContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	bw := bufio.NewWriter(w)
+	m.write(bw)
+	bw.Flush() //nolint:errcheck
+}
+
+func (m *Metrics) write(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	labels := make([]metricLabels, 0, len(m.series))
+	for l := range m.series {
+		labels = append(labels, l)
+	}
+	slices.SortFunc(labels, compareMetricLabels)
+
+	fmt.Fprintln(w, "# HELP unisrv_http_requests_total Total number of HTTP requests.")
+	fmt.Fprintln(w, "# TYPE unisrv_http_requests_total counter")
+	for _, l := range labels {
+		fmt.Fprintf(w, "unisrv_http_requests_total{%s} %d\n", l, m.series[l].requests)
+	}
+
+	fmt.Fprintln(w, "# HELP unisrv_http_response_bytes_total Total bytes of HTTP response bodies served.")
+	fmt.Fprintln(w, "# TYPE unisrv_http_response_bytes_total counter")
+	for _, l := range labels {
+		fmt.Fprintf(w, "unisrv_http_response_bytes_total{%s} %d\n", l, m.series[l].bytes)
+	}
+
+	fmt.Fprintln(w, "# HELP unisrv_http_request_duration_seconds Duration of HTTP requests in seconds.")
+	fmt.Fprintln(w, "# TYPE unisrv_http_request_duration_seconds histogram")
+	for _, l := range labels {
+		s := m.series[l]
+		var cumulative uint64
+		for i, le := range durationBuckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(w, "unisrv_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				l, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "unisrv_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", l, s.requests)
+		fmt.Fprintf(w, "unisrv_http_request_duration_seconds_sum{%s} %s\n",
+			l, strconv.FormatFloat(s.duration, 'g', -1, 64))
+		fmt.Fprintf(w, "unisrv_http_request_duration_seconds_count{%s} %d\n", l, s.requests)
+	}
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectMetrics(t *testing.T) {
+	m := NewMetrics()
+
+	h := CollectMetrics(m, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Build/Build.wasm.br":
+			w.Header().Set("Content-Encoding", "br")
+			fmt.Fprint(w, "wasm")
+		case "/Build/Build.data.gz":
+			w.Header().Set("Content-Encoding", "gzip")
+			fmt.Fprint(w, "data")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	for _, target := range []string{"/Build/Build.wasm.br", "/Build/Build.wasm.br", "/Build/Build.data.gz", "/missing"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if actual := w.Header().Get("Content-Type"); actual != metricsContentType {
+		t.Errorf("expected %q, but got %q", metricsContentType, actual)
+	}
+
+	body := w.Body.String()
+	expectedLines := []string{
+		"# TYPE unisrv_http_requests_total counter",
+		`unisrv_http_requests_total{asset="data",encoding="gzip",status="200"} 1`,
+		`unisrv_http_requests_total{asset="other",encoding="identity",status="404"} 1`,
+		`unisrv_http_requests_total{asset="wasm",encoding="br",status="200"} 2`,
+		"# TYPE unisrv_http_response_bytes_total counter",
+		`unisrv_http_response_bytes_total{asset="wasm",encoding="br",status="200"} 8`,
+		"# TYPE unisrv_http_request_duration_seconds histogram",
+		`unisrv_http_request_duration_seconds_bucket{asset="wasm",encoding="br",status="200",le="60"} 2`,
+		`unisrv_http_request_duration_seconds_bucket{asset="wasm",encoding="br",status="200",le="+Inf"} 2`,
+		`unisrv_http_request_duration_seconds_count{asset="wasm",encoding="br",status="200"} 2`,
+	}
+	for _, expected := range expectedLines {
+		if !strings.Contains(body, expected+"\n") {
+			t.Errorf("expected %q to contain %q", body, expected)
+		}
+	}
+
+	// Series are sorted by labels.
+	data := strings.Index(body, `unisrv_http_requests_total{asset="data"`)
+	wasm := strings.Index(body, `unisrv_http_requests_total{asset="wasm"`)
+	if data > wasm {
+		t.Errorf("expected series to be sorted, but got %q", body)
+	}
+}
+
+func TestCollectMetricsInRequestLogger(t *testing.T) {
+	m := NewMetrics()
+
+	var buf strings.Builder
+	accessLogger, err := NewAccessLogger(&buf, AccessLogFormatCommon)
+	if err != nil {
+		t.Fatalf("failed to create access logger: %+v", err)
+	}
+
+	h := RequestLogger(accessLogger, CollectMetrics(m, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw, ok := w.(*responseWriter)
+		if !ok {
+			t.Fatalf("expected *responseWriter, but got %T", w)
+		}
+		if inner, ok := rw.ResponseWriter.(*responseWriter); ok {
+			t.Errorf("expected the response writer to be wrapped once, but got %T in it", inner)
+		}
+		fmt.Fprint(w, "data")
+	})))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/Build/Build.data", nil))
+
+	if expected := `"GET /Build/Build.data HTTP/1.1" 200 4`; !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected %q to contain %q", buf.String(), expected)
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	expected := `unisrv_http_response_bytes_total{asset="data",encoding="identity",status="200"} 4`
+	if body := w.Body.String(); !strings.Contains(body, expected+"\n") {
+		t.Errorf("expected %q to contain %q", body, expected)
+	}
+}
+
+func TestMetricsObserve(t *testing.T) {
+	m := NewMetrics()
+	labels := metricLabels{status: http.StatusOK, encoding: "identity", asset: "other"}
+
+	m.observe(labels, 10*time.Millisecond, 1)
+	m.observe(labels, 2*time.Second, 1)
+	m.observe(labels, 2*time.Minute, 1)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+
+	cases := []struct {
+		le       string
+		expected int
+	}{
+		{le: "0.005", expected: 0},
+		{le: "0.01", expected: 1},
+		{le: "2.5", expected: 2},
+		{le: "60", expected: 2},
+		{le: "+Inf", expected: 3},
+	}
+
+	for _, v := range cases {
+		t.Run(v.le, func(tt *testing.T) {
+			expected := fmt.Sprintf(`unisrv_http_request_duration_seconds_bucket{%s,le="%s"} %d`, labels, v.le, v.expected)
+			if !strings.Contains(body, expected+"\n") {
+				tt.Errorf("expected %q to contain %q", body, expected)
+			}
+		})
+	}
+
+	expected := fmt.Sprintf("unisrv_http_request_duration_seconds_sum{%s} 122.01\n", labels)
+	if !strings.Contains(body, expected) {
+		t.Errorf("expected %q to contain %q", body, expected)
+	}
+}
+
+func TestMetricsMethodNotAllowed(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewMetrics().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected %d, but got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
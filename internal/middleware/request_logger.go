@@ -1,32 +1,286 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 )
 
-var logger = log.New(os.Stdout, "", log.LstdFlags)
+// logger writes messages other than access logs, e.g. injected faults, to stderr.
+var logger = log.New(os.Stderr, "", log.LstdFlags)
 
-// RequestLogger is a middleware that prints simple access logs.
-func RequestLogger(next http.Handler) http.Handler {
+// requestIDHeader is the header to propagate the request ID.
+const requestIDHeader = "X-Request-Id"
+
+// requestIDSize is the number of random bytes of the generated request ID.
+const requestIDSize = 8
+
+// clfTimeFormat is the layout of the time in Common Log Format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogFormat is a format of access logs.
+// It is one of the predefined formats or a text/template executed with AccessLog.
+type AccessLogFormat string
+
+const (
+	// AccessLogFormatText writes access logs as logfmt style key=value pairs.
+	AccessLogFormatText AccessLogFormat = "text"
+	// AccessLogFormatJSON writes access logs as JSON lines.
+	AccessLogFormatJSON AccessLogFormat = "json"
+	// AccessLogFormatCommon writes access logs in Common Log Format.
+	AccessLogFormatCommon AccessLogFormat = "common"
+	// AccessLogFormatCombined writes access logs in Combined Log Format.
+	AccessLogFormatCombined AccessLogFormat = "combined"
+)
+
+const commonLogTemplate = `{{.RemoteHost}} - - [{{.CLFTime}}] "{{escape .RequestLine}}" {{.Status}} {{.CLFBytes}}`
+
+// accessLogTemplates are the templates of the predefined formats.
+var accessLogTemplates = map[AccessLogFormat]string{
+	AccessLogFormatCommon:   commonLogTemplate,
+	AccessLogFormatCombined: commonLogTemplate + ` "{{dash (escape .Referer)}}" "{{dash (escape .UserAgent)}}"`,
+}
+
+var accessLogFuncs = template.FuncMap{
+	"escape": escapeLogValue,
+	"dash":   dashEmpty,
+}
+
+// ParseAccessLogFormat parses the access log format. An empty string means AccessLogFormatText.
+// A value containing "{{" is parsed as a template.
+func ParseAccessLogFormat(s string) (AccessLogFormat, error) {
+	switch format := AccessLogFormat(s); format {
+	case "":
+		return AccessLogFormatText, nil
+	case AccessLogFormatText, AccessLogFormatJSON, AccessLogFormatCommon, AccessLogFormatCombined:
+		return format, nil
+	default:
+		if _, err := parseAccessLogTemplate(format); err != nil {
+			return "", err
+		}
+		return format, nil
+	}
+}
+
+// AccessLog is an entry of access logs.
+type AccessLog struct {
+	// Time is the time the request was received.
+	Time            time.Time
+	Method          string
+	URI             string
+	Proto           string
+	Status          int
+	Bytes           int64
+	Duration        time.Duration
+	RemoteAddr      string
+	ContentEncoding string
+	UserAgent       string
+	Referer         string
+	RequestID       string
+}
+
+// RemoteHost returns the host of the remote address without the port, or "-" if it is unknown.
+func (l *AccessLog) RemoteHost() string {
+	if l.RemoteAddr == "" {
+		return "-"
+	}
+	host, _, err := net.SplitHostPort(l.RemoteAddr)
+	if err != nil {
+		return l.RemoteAddr
+	}
+	return host
+}
+
+// RequestLine returns the request line, e.g. `GET / HTTP/1.1`.
+func (l *AccessLog) RequestLine() string {
+	return l.Method + " " + l.URI + " " + l.Proto
+}
+
+// CLFTime returns the time in the layout of Common Log Format.
+func (l *AccessLog) CLFTime() string {
+	return l.Time.Format(clfTimeFormat)
+}
+
+// CLFBytes returns the bytes written in Common Log Format, in which zero is "-".
+func (l *AccessLog) CLFBytes() string {
+	if l.Bytes == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(l.Bytes, 10)
+}
+
+// AccessLogger writes access logs.
+type AccessLogger interface {
+	LogAccess(entry *AccessLog)
+}
+
+// NewAccessLogger returns an AccessLogger writing access logs to w in the format.
+func NewAccessLogger(w io.Writer, format AccessLogFormat) (AccessLogger, error) {
+	switch format {
+	case "", AccessLogFormatText:
+		return &slogAccessLogger{logger: slog.New(slog.NewTextHandler(w, nil))}, nil
+	case AccessLogFormatJSON:
+		return &slogAccessLogger{logger: slog.New(slog.NewJSONHandler(w, nil))}, nil
+	default:
+		tmpl, err := parseAccessLogTemplate(format)
+		if err != nil {
+			return nil, err
+		}
+		return &templateAccessLogger{w: w, tmpl: tmpl}, nil
+	}
+}
+
+// RequestLogger is a middleware that logs each request to the access logger.
+// The request ID is taken from X-Request-Id header or generated, and is set to the response header.
+func RequestLogger(accessLogger AccessLogger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		rw := &responseWriter{
-			ResponseWriter: w,
+		start := time.Now()
+
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
 		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		rw := wrapResponseWriter(w)
 		defer func() {
-			logger.Printf(`"%s %s %s" - %d`, r.Method, r.RequestURI, r.Proto, rw.StatusCode())
+			accessLogger.LogAccess(&AccessLog{
+				Time:            start,
+				Method:          r.Method,
+				URI:             r.RequestURI,
+				Proto:           r.Proto,
+				Status:          rw.StatusCode(),
+				Bytes:           rw.BytesWritten(),
+				Duration:        time.Since(start),
+				RemoteAddr:      r.RemoteAddr,
+				ContentEncoding: w.Header().Get("Content-Encoding"),
+				UserAgent:       r.UserAgent(),
+				Referer:         r.Referer(),
+				RequestID:       requestID,
+			})
 		}()
 
 		next.ServeHTTP(rw, r)
 	})
 }
 
+// slogAccessLogger writes access logs with slog.
+type slogAccessLogger struct {
+	logger *slog.Logger
+}
+
+func (l *slogAccessLogger) LogAccess(entry *AccessLog) {
+	l.logger.LogAttrs(context.Background(), slog.LevelInfo, "request",
+		slog.String("method", entry.Method),
+		slog.String("uri", entry.URI),
+		slog.String("proto", entry.Proto),
+		slog.Int("status", entry.Status),
+		slog.Int64("bytes", entry.Bytes),
+		slog.Duration("duration", entry.Duration),
+		slog.String("remote_addr", entry.RemoteAddr),
+		slog.String("content_encoding", entry.ContentEncoding),
+		slog.String("user_agent", entry.UserAgent),
+		slog.String("referer", entry.Referer),
+		slog.String("request_id", entry.RequestID),
+	)
+}
+
+// templateAccessLogger writes access logs formatted with the template line by line.
+type templateAccessLogger struct {
+	mu   sync.Mutex
+	w    io.Writer
+	tmpl *template.Template
+}
+
+func (l *templateAccessLogger) LogAccess(entry *AccessLog) {
+	var buf bytes.Buffer
+	if err := l.tmpl.Execute(&buf, entry); err != nil {
+		logger.Printf("access log: %v", err)
+		return
+	}
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(buf.Bytes()); err != nil {
+		logger.Printf("access log: %v", err)
+	}
+}
+
+// parseAccessLogTemplate parses the template of the predefined or custom format
+// and checks it can be executed with AccessLog.
+func parseAccessLogTemplate(format AccessLogFormat) (*template.Template, error) {
+	text, ok := accessLogTemplates[format]
+	if !ok {
+		if !strings.Contains(string(format), "{{") {
+			return nil, fmt.Errorf("invalid format %q: must be %s, %s, %s, %s or a template", format,
+				AccessLogFormatText, AccessLogFormatJSON, AccessLogFormatCommon, AccessLogFormatCombined)
+		}
+		text = string(format)
+	}
+
+	tmpl, err := template.New("access-log").Funcs(accessLogFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	if err := tmpl.Execute(io.Discard, &AccessLog{}); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// dashEmpty returns "-" for the empty value as Common Log Format does.
+func dashEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escapeLogValue escapes quotes, backslashes and non-printable characters in the value.
+func escapeLogValue(s string) string {
+	quoted := strconv.Quote(s)
+	return quoted[1 : len(quoted)-1]
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	b := make([]byte, requestIDSize)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	wroteHeader bool
 	code        int
+	bytes       int64
+}
+
+// wrapResponseWriter wraps w to record the status and the bytes written.
+// It returns w itself if it has already been wrapped by an outer middleware.
+func wrapResponseWriter(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+	return &responseWriter{
+		ResponseWriter: w,
+	}
 }
 
 func (s *responseWriter) Write(p []byte) (int, error) {
@@ -35,6 +289,7 @@ func (s *responseWriter) Write(p []byte) (int, error) {
 	}
 
 	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
 	if err != nil {
 		return n, fmt.Errorf("write: %w", err)
 	}
@@ -51,3 +306,13 @@ func (s *responseWriter) WriteHeader(code int) {
 func (s *responseWriter) StatusCode() int {
 	return s.code
 }
+
+// BytesWritten returns the number of bytes of the response body written.
+func (s *responseWriter) BytesWritten() int64 {
+	return s.bytes
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (s *responseWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -1,12 +1,219 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
+func TestParseAccessLogFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		expected AccessLogFormat
+		failed   bool
+	}{
+		{name: "empty", input: "", expected: AccessLogFormatText},
+		{name: "text", input: "text", expected: AccessLogFormatText},
+		{name: "json", input: "json", expected: AccessLogFormatJSON},
+		{name: "common", input: "common", expected: AccessLogFormatCommon},
+		{name: "combined", input: "combined", expected: AccessLogFormatCombined},
+		{name: "template", input: "{{.Method}} {{.Status}}", expected: "{{.Method}} {{.Status}}"},
+		{name: "invalid", input: "xml", failed: true},
+		{name: "invalid template syntax", input: "{{.Method", failed: true},
+		{name: "unknown template field", input: "{{.Unknown}}", failed: true},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			format, err := ParseAccessLogFormat(v.input)
+
+			switch {
+			case err != nil && !v.failed:
+				tt.Fatalf("unexpected error: %+v", err)
+			case err == nil && v.failed:
+				tt.Fatalf("unexpected success")
+			default:
+				// nop
+			}
+
+			if format != v.expected {
+				tt.Errorf("expected %q, but got %q", v.expected, format)
+			}
+		})
+	}
+}
+
+func TestTemplateAccessLogger(t *testing.T) {
+	entry := &AccessLog{
+		Time:       time.Date(2024, time.March, 1, 12, 34, 56, 0, time.FixedZone("", 9*60*60)),
+		Method:     http.MethodGet,
+		URI:        "/Build/Build.wasm",
+		Proto:      "HTTP/1.1",
+		Status:     http.StatusOK,
+		Bytes:      1024,
+		Duration:   1500 * time.Millisecond,
+		RemoteAddr: "192.0.2.1:1234",
+		UserAgent:  `Mozilla/5.0 "test"`,
+		Referer:    "http://localhost:5000/",
+		RequestID:  "abc123",
+	}
+
+	cases := []struct {
+		name     string
+		format   AccessLogFormat
+		entry    *AccessLog
+		expected string
+	}{
+		{
+			name:     "common",
+			format:   AccessLogFormatCommon,
+			entry:    entry,
+			expected: `192.0.2.1 - - [01/Mar/2024:12:34:56 +0900] "GET /Build/Build.wasm HTTP/1.1" 200 1024` + "\n",
+		},
+		{
+			name:   "combined",
+			format: AccessLogFormatCombined,
+			entry:  entry,
+			expected: `192.0.2.1 - - [01/Mar/2024:12:34:56 +0900] "GET /Build/Build.wasm HTTP/1.1" 200 1024 ` +
+				`"http://localhost:5000/" "Mozilla/5.0 \"test\""` + "\n",
+		},
+		{
+			name:     "combined without referer and user agent",
+			format:   AccessLogFormatCombined,
+			entry:    &AccessLog{Time: entry.Time, Method: "GET", URI: "/", Proto: "HTTP/1.1", Status: 200, Bytes: 3},
+			expected: `- - - [01/Mar/2024:12:34:56 +0900] "GET / HTTP/1.1" 200 3 "-" "-"` + "\n",
+		},
+		{
+			name:     "no bytes",
+			format:   AccessLogFormatCommon,
+			entry:    &AccessLog{Time: entry.Time, Method: "HEAD", URI: "/", Proto: "HTTP/1.1", Status: 304},
+			expected: `- - - [01/Mar/2024:12:34:56 +0900] "HEAD / HTTP/1.1" 304 -` + "\n",
+		},
+		{
+			name:     "template",
+			format:   "{{.RequestID}} {{.Status}} {{.Duration}}",
+			entry:    entry,
+			expected: "abc123 200 1.5s\n",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			var buf bytes.Buffer
+			accessLogger, err := NewAccessLogger(&buf, v.format)
+			if err != nil {
+				tt.Fatalf("unexpected error: %+v", err)
+			}
+
+			accessLogger.LogAccess(v.entry)
+
+			if actual := buf.String(); actual != v.expected {
+				tt.Errorf("expected %q, but got %q", v.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, "hello")
+	})
+
+	cases := []struct {
+		name      string
+		requestID string
+	}{
+		{name: "generated request ID"},
+		{name: "given request ID", requestID: "abc123"},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			var buf bytes.Buffer
+			accessLogger, err := NewAccessLogger(&buf, AccessLogFormatJSON)
+			if err != nil {
+				tt.Fatalf("unexpected error: %+v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/Build/Build.wasm?v=1", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			r.Header.Set("User-Agent", "test-agent")
+			r.Header.Set("Referer", "http://localhost:5000/")
+			if v.requestID != "" {
+				r.Header.Set("X-Request-Id", v.requestID)
+			}
+			w := httptest.NewRecorder()
+			RequestLogger(accessLogger, h).ServeHTTP(w, r)
+
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				tt.Fatalf("unexpected error: %+v", err)
+			}
+
+			requestID := w.Header().Get("X-Request-Id")
+			if v.requestID != "" && requestID != v.requestID {
+				tt.Errorf("expected request ID %q, but got %q", v.requestID, requestID)
+			}
+			if requestID == "" {
+				tt.Errorf("expected request ID to be set")
+			}
+
+			expected := map[string]any{
+				"msg":              "request",
+				"method":           "GET",
+				"uri":              "/Build/Build.wasm?v=1",
+				"proto":            "HTTP/1.1",
+				"status":           float64(http.StatusCreated),
+				"bytes":            float64(len("hello")),
+				"remote_addr":      "192.0.2.1:1234",
+				"content_encoding": "gzip",
+				"user_agent":       "test-agent",
+				"referer":          "http://localhost:5000/",
+				"request_id":       requestID,
+			}
+			for key, value := range expected {
+				if entry[key] != value {
+					tt.Errorf("expected %s to be %v, but got %v", key, value, entry[key])
+				}
+			}
+			if _, ok := entry["duration"]; !ok {
+				tt.Errorf("expected duration to be logged")
+			}
+		})
+	}
+
+	t.Run("text", func(tt *testing.T) {
+		var buf bytes.Buffer
+		accessLogger, err := NewAccessLogger(&buf, AccessLogFormatText)
+		if err != nil {
+			tt.Fatalf("unexpected error: %+v", err)
+		}
+
+		RequestLogger(accessLogger, h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		for _, expected := range []string{"msg=request", "method=GET", "status=201", "bytes=5"} {
+			if !strings.Contains(buf.String(), expected) {
+				tt.Errorf("expected %q to contain %q", buf.String(), expected)
+			}
+		}
+	})
+
+	t.Run("invalid format", func(tt *testing.T) {
+		if _, err := NewAccessLogger(io.Discard, "xml"); err == nil {
+			tt.Errorf("unexpected success")
+		}
+	})
+}
+
 func TestResponseWriter(t *testing.T) {
 	t.Run("write without writing header", func(tt *testing.T) {
 		w := httptest.NewRecorder()
@@ -20,6 +227,10 @@ func TestResponseWriter(t *testing.T) {
 		if statusCode != http.StatusOK {
 			tt.Errorf("expected %d, but got %d", http.StatusOK, statusCode)
 		}
+
+		if n := rw.BytesWritten(); n != 2 {
+			tt.Errorf("expected %d, but got %d", 2, n)
+		}
 	})
 
 	t.Run("write header", func(tt *testing.T) {
@@ -0,0 +1,263 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frozenbonito/unisrv/internal/pathpattern"
+)
+
+// throttleInterval is the interval to write chunks of throttled responses.
+const throttleInterval = 100 * time.Millisecond
+
+// minThrottleChunkSize is the minimum size of chunks of throttled responses.
+const minThrottleChunkSize = 512
+
+// throttleLinkIdleTimeout is the duration after which idle links are discarded.
+const throttleLinkIdleTimeout = time.Minute
+
+// ThrottleProfile describes network conditions to simulate.
+type ThrottleProfile struct {
+	// Bandwidth is the download bandwidth in bytes per second.
+	// Zero means unlimited.
+	Bandwidth int64
+	// Latency is the delay before the response starts.
+	Latency time.Duration
+}
+
+// ThrottlePresets is the map of throttle profiles by name.
+// They are based on the network throttling presets of Chrome DevTools.
+var ThrottlePresets = map[string]ThrottleProfile{
+	"slow-3g": {Bandwidth: kbps(400), Latency: 2000 * time.Millisecond},
+	"3g":      {Bandwidth: kbps(1600), Latency: 563 * time.Millisecond},
+	"4g":      {Bandwidth: kbps(9000), Latency: 170 * time.Millisecond},
+	"none":    {},
+}
+
+// kbps converts kilobits per second to bytes per second.
+func kbps(n int64) int64 {
+	return n * 1000 / 8 //nolint:mnd
+}
+
+// ParseThrottleProfile parses the name of the preset or the bandwidth, e.g. `3g`, `500kbps` or `2mbps`.
+// A bandwidth without unit is in kbps.
+func ParseThrottleProfile(s string) (ThrottleProfile, error) {
+	if p, ok := ThrottlePresets[s]; ok {
+		return p, nil
+	}
+
+	lower := strings.ToLower(s)
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(lower, "mbps"):
+		unit = 1000
+		lower = strings.TrimSuffix(lower, "mbps")
+	case strings.HasSuffix(lower, "kbps"):
+		lower = strings.TrimSuffix(lower, "kbps")
+	}
+
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n <= 0 {
+		return ThrottleProfile{}, fmt.Errorf("invalid throttle profile %q: must be a preset or bandwidth in kbps", s)
+	}
+	return ThrottleProfile{Bandwidth: kbps(n * unit)}, nil
+}
+
+// ThrottleRule applies the profile to paths matching the pattern.
+type ThrottleRule struct {
+	Pattern *pathpattern.Pattern
+	Profile ThrottleProfile
+}
+
+// ThrottleConfig describes config of the throttling middleware.
+type ThrottleConfig struct {
+	// Base is the base path which is trimmed from paths before matching rules.
+	Base string
+	// Default is the profile applied to paths which no rule matches.
+	Default ThrottleProfile
+	// Rules is the list of per-path profiles. The first rule matching the path is applied.
+	Rules []ThrottleRule
+}
+
+// profile returns the throttle profile for the request path.
+func (s *ThrottleConfig) profile(urlPath string) ThrottleProfile {
+	name := strings.TrimPrefix(urlPath, strings.TrimSuffix(s.Base, "/"))
+	for _, rule := range s.Rules {
+		if rule.Pattern.Match(name) {
+			return rule.Profile
+		}
+	}
+	return s.Default
+}
+
+// Throttle is a middleware that simulates slow networks by delaying responses and limiting their bandwidth.
+//
+// The bandwidth is shared by concurrent responses to the same client with the same profile
+// as they would share a network link, e.g. the data, wasm and framework files fetched by Unity loader in parallel.
+func Throttle(cfg *ThrottleConfig, next http.Handler) http.Handler {
+	links := &throttleLinks{
+		links: make(map[throttleLinkKey]*throttleLink),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := cfg.profile(r.URL.Path)
+		if p.Bandwidth == 0 && p.Latency == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		// Throttled responses take longer than the write timeout of the server.
+		rc.SetWriteDeadline(time.Time{}) //nolint:errcheck
+
+		if err := sleep(r.Context(), p.Latency); err != nil {
+			return
+		}
+
+		if p.Bandwidth == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		link := links.get(clientHost(r), p.Bandwidth)
+		next.ServeHTTP(newThrottledWriter(r.Context(), w, links, link), r)
+	})
+}
+
+// throttleLinks is the simulated network links of clients.
+type throttleLinks struct {
+	mu    sync.Mutex
+	links map[throttleLinkKey]*throttleLink
+}
+
+// throttleLinkKey identifies the link of a client with a bandwidth.
+type throttleLinkKey struct {
+	host      string
+	bandwidth int64
+}
+
+// throttleLink is a simulated network link.
+type throttleLink struct {
+	bandwidth int64
+	// busyUntil is the time the link finishes sending the reserved bytes.
+	busyUntil time.Time
+}
+
+// get returns the link of the client with the bandwidth, discarding idle links.
+func (s *throttleLinks) get(host string, bandwidth int64) *throttleLink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, link := range s.links {
+		if now.Sub(link.busyUntil) > throttleLinkIdleTimeout {
+			delete(s.links, key)
+		}
+	}
+
+	key := throttleLinkKey{host: host, bandwidth: bandwidth}
+	link, ok := s.links[key]
+	if !ok {
+		link = &throttleLink{bandwidth: bandwidth}
+		s.links[key] = link
+	}
+	return link
+}
+
+// reserve reserves the link to send n bytes after the bytes reserved so far,
+// and returns the time they have been sent.
+func (s *throttleLinks) reserve(link *throttleLink, n int) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if link.busyUntil.Before(now) {
+		link.busyUntil = now
+	}
+	link.busyUntil = link.busyUntil.Add(time.Duration(int64(n) * int64(time.Second) / link.bandwidth))
+	return link.busyUntil
+}
+
+// clientHost returns the host of the client address of the request.
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// throttledWriter is a http.ResponseWriter that limits the bandwidth of the response body to the link.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx       context.Context
+	rc        *http.ResponseController
+	links     *throttleLinks
+	link      *throttleLink
+	chunkSize int
+}
+
+// newThrottledWriter returns a throttledWriter which writes through the link.
+func newThrottledWriter(
+	ctx context.Context, w http.ResponseWriter, links *throttleLinks, link *throttleLink,
+) *throttledWriter {
+	chunkSize := int(link.bandwidth * int64(throttleInterval) / int64(time.Second))
+	return &throttledWriter{
+		ResponseWriter: w,
+		ctx:            ctx,
+		rc:             http.NewResponseController(w),
+		links:          links,
+		link:           link,
+		chunkSize:      max(chunkSize, minThrottleChunkSize),
+	}
+}
+
+func (s *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), s.chunkSize)]
+		n, err := s.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, fmt.Errorf("write: %w", err)
+		}
+		p = p[n:]
+
+		// Let the client observe the progress.
+		s.rc.Flush() //nolint:errcheck
+
+		due := s.links.reserve(s.link, n)
+		if err := sleep(s.ctx, time.Until(due)); err != nil {
+			return written, fmt.Errorf("throttle: %w", err)
+		}
+	}
+	return written, nil
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (s *throttledWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// sleep pauses for the duration or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frozenbonito/unisrv/internal/pathpattern"
+)
+
+func TestParseThrottleProfile(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected ThrottleProfile
+		err      string
+	}{
+		{
+			input:    "3g",
+			expected: ThrottlePresets["3g"],
+		},
+		{
+			input:    "800",
+			expected: ThrottleProfile{Bandwidth: 100000},
+		},
+		{
+			input:    "800kbps",
+			expected: ThrottleProfile{Bandwidth: 100000},
+		},
+		{
+			input:    "2Mbps",
+			expected: ThrottleProfile{Bandwidth: 250000},
+		},
+		{
+			input: "0",
+			err:   `invalid throttle profile "0": must be a preset or bandwidth in kbps`,
+		},
+		{
+			input: "5g",
+			err:   `invalid throttle profile "5g": must be a preset or bandwidth in kbps`,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.input, func(tt *testing.T) {
+			p, err := ParseThrottleProfile(v.input)
+			switch {
+			case err != nil && err.Error() != v.err:
+				tt.Errorf("expected %q, but got %q", v.err, err.Error())
+			case err == nil && v.err != "":
+				tt.Errorf("unexpected success")
+			case p != v.expected:
+				tt.Errorf("expected %+v, but got %+v", v.expected, p)
+			default:
+				// nop
+			}
+		})
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 20000)
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(body) //nolint:errcheck
+	})
+
+	h := Throttle(&ThrottleConfig{
+		Base:    "/base/",
+		Default: ThrottleProfile{Bandwidth: 100000, Latency: 50 * time.Millisecond},
+		Rules: []ThrottleRule{
+			{Pattern: pathpattern.MustCompile("*.html"), Profile: ThrottlePresets["none"]},
+			{Pattern: pathpattern.MustCompile("Build/*"), Profile: ThrottleProfile{Latency: 100 * time.Millisecond}},
+		},
+	}, next)
+
+	cases := []struct {
+		name string
+		path string
+		min  time.Duration
+		max  time.Duration
+	}{
+		{
+			name: "default",
+			path: "/base/TemplateData/style.css",
+			min:  250 * time.Millisecond,
+			max:  time.Second,
+		},
+		{
+			name: "unlimited",
+			path: "/base/index.html",
+			min:  0,
+			max:  50 * time.Millisecond,
+		},
+		{
+			name: "latency only",
+			path: "/base/Build/Build.data",
+			min:  100 * time.Millisecond,
+			max:  500 * time.Millisecond,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, v.path, nil)
+			w := httptest.NewRecorder()
+
+			start := time.Now()
+			h.ServeHTTP(w, r)
+			elapsed := time.Since(start)
+
+			if elapsed < v.min || elapsed > v.max {
+				tt.Errorf("expected between %v and %v, but got %v", v.min, v.max, elapsed)
+			}
+			if !bytes.Equal(w.Body.Bytes(), body) {
+				tt.Errorf("body is broken")
+			}
+		})
+	}
+
+	t.Run("canceled", func(tt *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		r := httptest.NewRequest(http.MethodGet, "/base/TemplateData/style.css", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+
+		start := time.Now()
+		h.ServeHTTP(w, r)
+		elapsed := time.Since(start)
+
+		if elapsed > 150*time.Millisecond {
+			tt.Errorf("expected to be canceled, but took %v", elapsed)
+		}
+		if w.Body.Len() >= len(body) {
+			tt.Errorf("expected partial body, but got %d bytes", w.Body.Len())
+		}
+	})
+}
+
+func TestThrottleConcurrentDownloads(t *testing.T) {
+	const downloads = 3
+
+	body := bytes.Repeat([]byte("a"), 20000)
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(body) //nolint:errcheck
+	})
+
+	cases := []struct {
+		name        string
+		remoteAddrs []string
+		min         time.Duration
+		max         time.Duration
+	}{
+		{
+			// 60000 bytes in total share 100000 bytes per second.
+			name:        "same client",
+			remoteAddrs: []string{"192.0.2.1:1234", "192.0.2.1:1235", "192.0.2.1:1236"},
+			min:         500 * time.Millisecond,
+			max:         2 * time.Second,
+		},
+		{
+			// Each client has its own link.
+			name:        "different clients",
+			remoteAddrs: []string{"192.0.2.1:1234", "192.0.2.2:1234", "192.0.2.3:1234"},
+			min:         150 * time.Millisecond,
+			max:         500 * time.Millisecond,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			h := Throttle(&ThrottleConfig{
+				Default: ThrottleProfile{Bandwidth: 100000},
+			}, next)
+
+			var wg sync.WaitGroup
+			recorders := make([]*httptest.ResponseRecorder, downloads)
+			start := time.Now()
+			for i := range downloads {
+				r := httptest.NewRequest(http.MethodGet, "/Build/Build.data", nil)
+				r.RemoteAddr = v.remoteAddrs[i]
+				recorders[i] = httptest.NewRecorder()
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					h.ServeHTTP(recorders[i], r)
+				}()
+			}
+			wg.Wait()
+			elapsed := time.Since(start)
+
+			if elapsed < v.min || elapsed > v.max {
+				tt.Errorf("expected between %v and %v, but got %v", v.min, v.max, elapsed)
+			}
+			for _, w := range recorders {
+				if !bytes.Equal(w.Body.Bytes(), body) {
+					tt.Errorf("body is broken")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Package pathpattern implements glob patterns for slash-separated URL paths.
+//
+// A pattern is a sequence of slash-separated segments.
+// Each segment is matched with path.Match, except that `**` matches zero or more segments.
+// A pattern without a slash matches the base name in any directory.
+// Leading slashes of both patterns and names are ignored.
+package pathpattern
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// doubleStar is the segment matching zero or more segments.
+const doubleStar = "**"
+
+// Pattern is a compiled path pattern.
+type Pattern struct {
+	raw      string
+	segments []string
+}
+
+// Compile parses the pattern.
+func Compile(pattern string) (*Pattern, error) {
+	trimmed := strings.TrimLeft(pattern, "/")
+	if trimmed == "" {
+		return nil, fmt.Errorf("empty pattern %q", pattern)
+	}
+
+	segments := strings.Split(trimmed, "/")
+	if !strings.Contains(trimmed, "/") && trimmed != doubleStar {
+		segments = []string{doubleStar, trimmed}
+	}
+
+	for _, seg := range segments {
+		if seg == doubleStar {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	return &Pattern{
+		raw:      pattern,
+		segments: segments,
+	}, nil
+}
+
+// MustCompile is like Compile but panics if the pattern is invalid.
+func MustCompile(pattern string) *Pattern {
+	p, err := Compile(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source text of the pattern.
+func (p *Pattern) String() string {
+	return p.raw
+}
+
+// Match reports whether the name matches the pattern.
+func (p *Pattern) Match(name string) bool {
+	return match(p.segments, strings.Split(strings.TrimLeft(name, "/"), "/"))
+}
+
+// match reports whether the name segments match the pattern segments.
+func match(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == doubleStar {
+			for i := 0; i <= len(name); i++ {
+				if match(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,85 @@
+package pathpattern_test
+
+import (
+	"testing"
+
+	"github.com/frozenbonito/unisrv/internal/pathpattern"
+)
+
+func TestCompile(t *testing.T) {
+	cases := []struct {
+		name    string
+		pattern string
+		err     string
+	}{
+		{
+			name:    "valid",
+			pattern: "Build/*.js",
+		},
+		{
+			name:    "empty",
+			pattern: "",
+			err:     `empty pattern ""`,
+		},
+		{
+			name:    "slash only",
+			pattern: "/",
+			err:     `empty pattern "/"`,
+		},
+		{
+			name:    "malformed",
+			pattern: "Build/[a-",
+			err:     `invalid pattern "Build/[a-": syntax error in pattern`,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			_, err := pathpattern.Compile(v.pattern)
+			switch {
+			case err != nil && err.Error() != v.err:
+				tt.Errorf("expected %q, but got %q", v.err, err.Error())
+			case err == nil && v.err != "":
+				tt.Errorf("unexpected success")
+			default:
+				// nop
+			}
+		})
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		matched bool
+	}{
+		{pattern: "index.html", name: "index.html", matched: true},
+		{pattern: "index.html", name: "/index.html", matched: true},
+		{pattern: "index.html", name: "sub/index.html", matched: true},
+		{pattern: "/index.html", name: "sub/index.html", matched: true},
+		{pattern: "*.js", name: "Build/Build.loader.js", matched: true},
+		{pattern: "*.js", name: "Build/Build.wasm", matched: false},
+		{pattern: "Build/*", name: "Build/Build.wasm", matched: true},
+		{pattern: "Build/*", name: "Build/sub/Build.wasm", matched: false},
+		{pattern: "Build/*", name: "TemplateData/style.css", matched: false},
+		{pattern: "Build/**", name: "Build/sub/Build.wasm", matched: true},
+		{pattern: "**/*.wasm", name: "Build.wasm", matched: true},
+		{pattern: "**/*.wasm", name: "Build/sub/Build.wasm", matched: true},
+		{pattern: "**/Build/*.br", name: "a/b/Build/Build.data.br", matched: true},
+		{pattern: "**/Build/*.br", name: "a/b/Build/Build.data.gz", matched: false},
+		{pattern: "**", name: "", matched: true},
+		{pattern: "**", name: "a/b/c", matched: true},
+		{pattern: "[0-9a-f][0-9a-f].*", name: "Build/3f.data", matched: true},
+		{pattern: "[0-9a-f][0-9a-f].*", name: "Build/3g.data", matched: false},
+	}
+
+	for _, v := range cases {
+		t.Run(v.pattern+" "+v.name, func(tt *testing.T) {
+			p := pathpattern.MustCompile(v.pattern)
+			if matched := p.Match(v.name); matched != v.matched {
+				tt.Errorf("expected %t, but got %t", v.matched, matched)
+			}
+		})
+	}
+}
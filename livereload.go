@@ -0,0 +1,213 @@
+package unisrv
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// liveReloadPath is the path of the event stream endpoint for live reload.
+const liveReloadPath = internalPathPrefix + "livereload"
+
+// liveReloadScript is the client script injected into HTML documents.
+// The placeholder is replaced with the URL of the event stream.
+const liveReloadScript = `<script>
+(() => {
+  const source = new EventSource(%q);
+  source.addEventListener("reload", () => location.reload());
+})();
+</script>
+`
+
+// LiveReload notifies connected browsers to reload Unity application over Server-Sent Events.
+type LiveReload struct {
+	mu       sync.Mutex
+	clients  map[chan struct{}]struct{}
+	closed   bool
+	onReload []func()
+	onStream []func(r *http.Request)
+}
+
+// NewLiveReload returns a new LiveReload.
+func NewLiveReload() *LiveReload {
+	return &LiveReload{
+		clients: make(map[chan struct{}]struct{}),
+	}
+}
+
+// OnReload registers f to be called before browsers are notified to reload,
+// e.g. to reload state derived from the build.
+func (s *LiveReload) OnReload(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onReload = append(s.onReload, f)
+}
+
+// OnStream registers f to be called with the request when an event stream starts,
+// e.g. to tell the long-lived connection from in-flight requests.
+func (s *LiveReload) OnStream(f func(r *http.Request)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onStream = append(s.onStream, f)
+}
+
+// Reload notifies all connected browsers to reload.
+func (s *LiveReload) Reload() {
+	s.mu.Lock()
+	onReload := s.onReload
+	s.mu.Unlock()
+
+	for _, f := range onReload {
+		f()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// A reload is already pending.
+		}
+	}
+}
+
+// Close disconnects all browsers.
+// It should be registered with http.Server.RegisterOnShutdown so that the event streams do not block shutdown.
+func (s *LiveReload) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for ch := range s.clients {
+		close(ch)
+		delete(s.clients, ch)
+	}
+}
+
+// ServeHTTP serves the event stream.
+func (s *LiveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ch, ok := s.subscribe()
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	defer s.unsubscribe(ch)
+
+	s.mu.Lock()
+	onStream := s.onStream
+	s.mu.Unlock()
+	for _, f := range onStream {
+		f(r)
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream lives longer than the write timeout of the server.
+	rc.SetWriteDeadline(time.Time{}) //nolint:errcheck
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+			fmt.Fprint(w, "event: reload\ndata: \n\n")
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Watch polls fsys at the interval and notifies browsers to reload when its content has changed
+// and then has not changed for the settle duration, e.g. Unity has finished writing a new build.
+// It blocks until ctx is done.
+func (s *LiveReload) Watch(ctx context.Context, fsys fs.FS, interval, settle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := snapshot(fsys)
+	var changedAt time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			current := snapshot(fsys)
+			if !maps.Equal(current, last) {
+				last = current
+				changedAt = now
+				continue
+			}
+			if !changedAt.IsZero() && now.Sub(changedAt) >= settle {
+				changedAt = time.Time{}
+				s.Reload()
+			}
+		}
+	}
+}
+
+func (s *LiveReload) subscribe() (chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, false
+	}
+
+	ch := make(chan struct{}, 1)
+	s.clients[ch] = struct{}{}
+	return ch, true
+}
+
+func (s *LiveReload) unsubscribe(ch chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.clients, ch)
+}
+
+// fileState is the state of a file used for detecting changes.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// snapshot returns the states of all files in fsys.
+// Files which cannot be read, e.g. being replaced, are omitted.
+func snapshot(fsys fs.FS) map[string]fileState {
+	files := make(map[string]fileState)
+	fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error { //nolint:errcheck
+		if err != nil || d.IsDir() {
+			return nil //nolint:nilerr
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil //nolint:nilerr
+		}
+		files[name] = fileState{
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		}
+		return nil
+	})
+	return files
+}
@@ -0,0 +1,230 @@
+package unisrv_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+func TestLiveReloadInjection(t *testing.T) {
+	cases := []struct {
+		name     string
+		base     string
+		path     string
+		injected bool
+	}{
+		{
+			name:     "index",
+			base:     "/",
+			path:     "/",
+			injected: true,
+		},
+		{
+			name:     "index with base",
+			base:     "/base/",
+			path:     "/base/",
+			injected: true,
+		},
+		{
+			name:     "asset",
+			base:     "/",
+			path:     "/Build/Build.framework.js.unityweb",
+			injected: false,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			h := unisrv.NewHandler("testdata", &unisrv.Options{
+				Base:       v.base,
+				LiveReload: unisrv.NewLiveReload(),
+			})
+
+			r := httptest.NewRequest(http.MethodGet, v.path, nil)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			b, err := io.ReadAll(resp.Body)
+			if err != nil {
+				tt.Fatalf("read failed: %+v", err)
+			}
+
+			tt.Run("body", func(ttt *testing.T) {
+				expected := v.base + "__unisrv/livereload"
+				injected := strings.Contains(string(b), expected)
+				if injected != v.injected {
+					ttt.Errorf("expected injected to be %v, but got %q", v.injected, string(b))
+				}
+				if !strings.HasPrefix(string(b), "testdata\n") {
+					ttt.Errorf("original body is broken: %q", string(b))
+				}
+			})
+
+			tt.Run("Content-Length header", func(ttt *testing.T) {
+				if resp.ContentLength != int64(len(b)) {
+					ttt.Errorf("expected %d, but got %d", len(b), resp.ContentLength)
+				}
+			})
+		})
+	}
+}
+
+func TestLiveReloadWatch(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(name, []byte("v1"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %+v", err)
+	}
+
+	liveReload := unisrv.NewLiveReload()
+	defer liveReload.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go liveReload.Watch(ctx, os.DirFS(dir), 10*time.Millisecond, 50*time.Millisecond)
+
+	srv := httptest.NewServer(unisrv.NewHandler(dir, &unisrv.Options{
+		LiveReload: liveReload,
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/__unisrv/livereload")
+	if err != nil {
+		t.Fatalf("request failed: %+v", err)
+	}
+	defer resp.Body.Close()
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "text/event-stream" {
+		t.Errorf("expected %q, but got %q", "text/event-stream", contentType)
+	}
+
+	if err := os.WriteFile(name, []byte("v2 build"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %+v", err)
+	}
+
+	event := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		event <- line
+	}()
+
+	select {
+	case line := <-event:
+		expected := "event: reload\n"
+		if line != expected {
+			t.Errorf("expected %q, but got %q", expected, line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("reload event is not received")
+	}
+}
+
+func TestLiveReloadOnReload(t *testing.T) {
+	liveReload := unisrv.NewLiveReload()
+	defer liveReload.Close()
+
+	called := 0
+	liveReload.OnReload(func() {
+		called++
+	})
+
+	liveReload.Reload()
+	liveReload.Reload()
+
+	if called != 2 {
+		t.Errorf("expected %d, but got %d", 2, called)
+	}
+}
+
+func TestLiveReloadOnStream(t *testing.T) {
+	liveReload := unisrv.NewLiveReload()
+
+	streams := make(chan string, 1)
+	liveReload.OnStream(func(r *http.Request) {
+		streams <- r.URL.Path
+	})
+
+	srv := httptest.NewServer(liveReload)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatalf("request failed: %+v", err)
+	}
+	defer resp.Body.Close()
+
+	if path := <-streams; path != "/stream" {
+		t.Errorf("expected %q, but got %q", "/stream", path)
+	}
+
+	// The stream ends when it is closed.
+	liveReload.Close()
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("read failed: %+v", err)
+	}
+}
+
+func TestLiveReloadEndpoint(t *testing.T) {
+	cases := []struct {
+		name string
+		base string
+		path string
+	}{
+		{
+			name: "root",
+			base: "/",
+			path: "/__unisrv/livereload",
+		},
+		{
+			name: "base",
+			base: "/base/",
+			path: "/base/__unisrv/livereload",
+		},
+		{
+			name: "base without trailing slash",
+			base: "/base",
+			path: "/base/__unisrv/livereload",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			liveReload := unisrv.NewLiveReload()
+			defer liveReload.Close()
+
+			srv := httptest.NewServer(unisrv.NewHandler("testdata", &unisrv.Options{
+				Base:       v.base,
+				LiveReload: liveReload,
+			}))
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + v.path)
+			if err != nil {
+				tt.Fatalf("request failed: %+v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				tt.Errorf("expected %d, but got %d", http.StatusOK, resp.StatusCode)
+			}
+			contentType := resp.Header.Get("Content-Type")
+			if contentType != "text/event-stream" {
+				tt.Errorf("expected %q, but got %q", "text/event-stream", contentType)
+			}
+		})
+	}
+}
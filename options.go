@@ -5,5 +5,39 @@ type Options struct {
 	// Base specifies the base path for the Unity application.
 	Base string
 	// NoCache specifies whether to set `Cache-Control: no-cache` header.
+	// It is applied to paths which no cache rule matches.
 	NoCache bool
+	// CacheRules specifies values of `Cache-Control` header for paths.
+	// The first rule matching the path is applied.
+	CacheRules []CacheRule
+	// ETag specifies whether to set strong `ETag` header computed from the content of files.
+	// Conditional requests with `If-None-Match` and `If-Range` headers are evaluated with it.
+	ETag bool
+	// LiveReload specifies the LiveReload to notify browsers to reload.
+	// If it is set, a script connecting to it is injected into HTML documents.
+	LiveReload *LiveReload
+	// ForwardConsole specifies the function called for each message of the browser console.
+	// If it is set, a script forwarding console output, uncaught errors and unhandled rejections
+	// is injected into HTML documents. It may be called concurrently.
+	ForwardConsole func(msg *ConsoleMessage)
+	// Symbols specifies the symbols of the WebAssembly build.
+	// If it is set, stack traces posted to `__unisrv/symbolicate` under the base path are symbolicated with it.
+	Symbols *Symbols
+	// CrossOriginIsolation specifies the `Cross-Origin-Embedder-Policy` to make pages cross-origin isolated.
+	// It is required for multithreaded builds which use SharedArrayBuffer.
+	// If it is empty, cross-origin isolation headers are not set.
+	CrossOriginIsolation CrossOriginIsolation
+	// CORS specifies options for Cross-Origin Resource Sharing.
+	// If it is nil, CORS headers are not set.
+	CORS *CORSOptions
 }
+
+// CrossOriginIsolation represents a value of `Cross-Origin-Embedder-Policy` header for cross-origin isolation.
+type CrossOriginIsolation string
+
+const (
+	// CrossOriginIsolationRequireCorp requires cross-origin resources to be allowed by CORS or CORP.
+	CrossOriginIsolationRequireCorp CrossOriginIsolation = "require-corp"
+	// CrossOriginIsolationCredentialless loads no-cors cross-origin resources without credentials.
+	CrossOriginIsolationCredentialless CrossOriginIsolation = "credentialless"
+)
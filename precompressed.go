@@ -0,0 +1,80 @@
+package unisrv
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// precompressedSiblings is a middleware that serves a precompressed sibling file
+// (e.g. `Build.wasm.br` for `Build.wasm`) when the requested file does not exist.
+//
+// Siblings whose encoding is accepted by the client are preferred.
+// If no acceptable sibling exists, the first existing one is served and decoded by UnityMiddleware.
+func precompressedSiblings(root http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path
+		if strings.HasSuffix(name, "/") || codingByExt(path.Ext(name)) != nil || !notExist(root, name) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sibling := findSibling(root, r, name)
+		if sibling == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = sibling
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// findSibling returns the path of the precompressed sibling file to serve for name.
+// It returns an empty string if there is no sibling file.
+func findSibling(root http.FileSystem, r *http.Request, name string) string {
+	fallback := ""
+	for _, c := range contentCodings {
+		sibling := name + c.ext
+		if !isFile(root, sibling) {
+			continue
+		}
+		if acceptsEncoding(r, c.name) {
+			return sibling
+		}
+		if fallback == "" {
+			fallback = sibling
+		}
+	}
+	return fallback
+}
+
+// notExist reports whether the named file does not exist in root.
+func notExist(root http.FileSystem, name string) bool {
+	f, err := root.Open(name)
+	if err != nil {
+		return errors.Is(err, fs.ErrNotExist)
+	}
+	f.Close()
+	return false
+}
+
+// isFile reports whether the named file exists in root and is not a directory.
+func isFile(root http.FileSystem, name string) bool {
+	f, err := root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,133 @@
+package unisrv
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// unitywebExt is the file extension of Unity assets built with "Decompression Fallback"
+// or by legacy Unity versions.
+const unitywebExt = ".unityweb"
+
+// sniffLen is the number of bytes enough to detect the content coding.
+const sniffLen = 64
+
+// unityBrotliComment is the comment embedded in Brotli compressed Unity assets.
+const unityBrotliComment = "UnityWeb Compressed Content (brotli)"
+
+// needsSniffing reports whether the content coding of the named asset should be
+// detected from its content.
+func needsSniffing(name string) bool {
+	ext := path.Ext(name)
+	return ext == unitywebExt || (ext == "" && name != "" && !strings.HasSuffix(name, "/"))
+}
+
+// sniffCoding detects the content coding from the beginning of the content.
+// It returns nil if the content is not compressed or the coding is unknown.
+func sniffCoding(p []byte) *contentCoding {
+	switch {
+	case len(p) >= 2 && p[0] == 0x1f && p[1] == 0x8b:
+		return codingByName("gzip")
+	case len(p) >= 4 && p[0] == 0x28 && p[1] == 0xb5 && p[2] == 0x2f && p[3] == 0xfd:
+		return codingByName("zstd")
+	case hasUnityBrotliMarker(p):
+		return codingByName("br")
+	default:
+		return nil
+	}
+}
+
+// hasUnityBrotliMarker reports whether the Brotli stream starts with the metadata block
+// containing the comment embedded by Unity.
+//
+// Brotli streams have no magic number, so only the ones produced by Unity are detected.
+func hasUnityBrotliMarker(p []byte) bool {
+	if len(p) == 0 {
+		return false
+	}
+
+	wbitsLength := 1
+	if p[0]&0x01 != 0 {
+		wbitsLength = 7
+		if p[0]&0x0e != 0 {
+			wbitsLength = 4
+		}
+	}
+	wbits := int(p[0]) & (1<<wbitsLength - 1)
+
+	// The comment length fits in a single MSKIPLEN byte.
+	const mskipBytes = 1
+	offset := (wbitsLength + 1 + 2 + 1 + 2 + mskipBytes*8 + 7) >> 3 //nolint:mnd
+	if wbits == 0x11 || offset+len(unityBrotliComment) > len(p) {
+		return false
+	}
+
+	// ISLAST = 0, MNIBBLES = 0 (metadata), reserved bit, MSKIPBYTES and MSKIPLEN - 1.
+	prefix := wbits + ((3<<1)+(mskipBytes<<4)+((len(unityBrotliComment)-1)<<6))<<wbitsLength //nolint:mnd
+	for i := 0; i < offset; i++ {
+		if p[i] != byte(prefix) {
+			return false
+		}
+		prefix >>= 8
+	}
+
+	return string(p[offset:offset+len(unityBrotliComment)]) == unityBrotliComment
+}
+
+// errSniffed stops serving the body once enough bytes to detect the content coding have been written.
+var errSniffed = errors.New("content coding sniffed")
+
+// probeHeaders are the request headers removed from the probe so that the whole body is served.
+var probeHeaders = []string{
+	"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since",
+}
+
+// sniffNext detects the content coding of the asset served by next for the request
+// from the beginning of its body, without writing the response.
+// It works for HEAD requests and byte ranges too, since the asset is probed with a plain GET request.
+// It returns nil if the asset is not served successfully or is not compressed.
+func sniffNext(next http.Handler, r *http.Request) *contentCoding {
+	probe := r.Clone(r.Context())
+	probe.Method = http.MethodGet
+	for _, name := range probeHeaders {
+		probe.Header.Del(name)
+	}
+
+	w := &sniffingWriter{header: http.Header{}}
+	next.ServeHTTP(w, probe)
+	if w.code != http.StatusOK {
+		return nil
+	}
+	return sniffCoding(w.head)
+}
+
+// sniffingWriter is a http.ResponseWriter that keeps the beginning of the body for sniffing
+// and discards the rest of the response.
+type sniffingWriter struct {
+	header http.Header
+	code   int
+	head   []byte
+}
+
+func (s *sniffingWriter) Header() http.Header {
+	return s.header
+}
+
+func (s *sniffingWriter) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+}
+
+func (s *sniffingWriter) Write(p []byte) (int, error) {
+	s.WriteHeader(http.StatusOK)
+
+	n := min(len(p), sniffLen-len(s.head))
+	s.head = append(s.head, p[:n]...)
+	if len(s.head) >= sniffLen {
+		return n, errSniffed
+	}
+	return len(p), nil
+}
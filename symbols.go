@@ -0,0 +1,208 @@
+package unisrv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// symbolicatePath is the path of the endpoint symbolicating posted stack traces.
+const symbolicatePath = internalPathPrefix + "symbolicate"
+
+// maxSymbolicateBodySize is the maximum size of a request body of the symbolicate endpoint.
+const maxSymbolicateBodySize = 10 << 20
+
+// symbolsSuffix is the suffix of the symbols file of Unity WebAssembly builds.
+const symbolsSuffix = ".symbols.json"
+
+// wasmFunctionPattern matches WebAssembly function frames in stack traces, e.g. `wasm-function[1234]`.
+var wasmFunctionPattern = regexp.MustCompile(`wasm-function\[(\d+)\]`)
+
+// Symbols maps indexes of WebAssembly functions to their names.
+// It is loaded from `.symbols.json` files emitted by Unity.
+// The zero value has no symbols.
+type Symbols struct {
+	mu        sync.RWMutex
+	functions map[int]string
+}
+
+// FindSymbols returns the name of the symbols file in fsys, e.g. `Build/Build.symbols.json.br`.
+// The error wraps fs.ErrNotExist if there is no symbols file.
+func FindSymbols(fsys fs.FS) (string, error) {
+	found := ""
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(trimCompressionExt(path.Base(name)), symbolsSuffix) {
+			found = name
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("walk: %w", err)
+	}
+	if found == "" {
+		return "", fmt.Errorf("find symbols file: %w", fs.ErrNotExist)
+	}
+
+	return found, nil
+}
+
+// LoadSymbols loads the named symbols file in fsys.
+// Compressed files are decoded according to their extensions.
+func LoadSymbols(fsys fs.FS, name string) (*Symbols, error) {
+	r, err := openDecoded(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", name, err)
+	}
+	defer r.Close()
+
+	s, err := ParseSymbols(r)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// ParseSymbols parses the symbols.
+//
+// It accepts a JSON object mapping function indexes to names, optionally nested in `functions` property,
+// and the Emscripten symbol map, which consists of `INDEX:NAME` lines.
+func ParseSymbols(r io.Reader) (*Symbols, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseSymbolsJSON(trimmed)
+	}
+	return parseSymbolMap(b)
+}
+
+// parseSymbolsJSON parses the symbols in JSON.
+func parseSymbolsJSON(b []byte) (*Symbols, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+	if functions, ok := obj["functions"]; ok {
+		obj = nil
+		if err := json.Unmarshal(functions, &obj); err != nil {
+			return nil, fmt.Errorf("decode functions: %w", err)
+		}
+	}
+
+	s := &Symbols{functions: make(map[int]string, len(obj))}
+	for key, value := range obj {
+		index, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid function index %q", key)
+		}
+		var name string
+		if err := json.Unmarshal(value, &name); err != nil {
+			return nil, fmt.Errorf("decode name of function %d: %w", index, err)
+		}
+		s.functions[index] = name
+	}
+	return s, nil
+}
+
+// parseSymbolMap parses the Emscripten symbol map.
+func parseSymbolMap(b []byte) (*Symbols, error) {
+	s := &Symbols{functions: make(map[int]string)}
+
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		key, name, ok := strings.Cut(text, ":")
+		index, err := strconv.Atoi(key)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("line %d: invalid symbol %q", line, text)
+		}
+		s.functions[index] = name
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+
+	if len(s.functions) == 0 {
+		return nil, errors.New("no symbols")
+	}
+	return s, nil
+}
+
+// Lookup returns the name of the function with the index.
+func (s *Symbols) Lookup(index int) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name, ok := s.functions[index]
+	return name, ok
+}
+
+// Update replaces the symbols with the ones of other, e.g. loaded from a rebuilt build.
+// A nil other removes all symbols.
+func (s *Symbols) Update(other *Symbols) {
+	var functions map[int]string
+	if other != nil {
+		other.mu.RLock()
+		functions = other.functions
+		other.mu.RUnlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.functions = functions
+}
+
+// Symbolicate replaces WebAssembly function frames in the stack trace, e.g. `wasm-function[1234]`,
+// with the function names. Frames of unknown functions are left as is.
+func (s *Symbols) Symbolicate(trace string) string {
+	return wasmFunctionPattern.ReplaceAllStringFunc(trace, func(frame string) string {
+		m := wasmFunctionPattern.FindStringSubmatch(frame)
+		index, err := strconv.Atoi(m[1])
+		if err != nil {
+			return frame
+		}
+		if name, ok := s.Lookup(index); ok {
+			return name
+		}
+		return frame
+	})
+}
+
+// ServeHTTP symbolicates the stack trace posted as the request body.
+func (s *Symbols) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSymbolicateBodySize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("read stack trace: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	io.WriteString(w, s.Symbolicate(string(b))) //nolint:errcheck
+}
@@ -0,0 +1,274 @@
+package unisrv_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+const symbolsJSON = `{"functions":{"12":"Player_Update_m1234","345":"il2cpp::vm::Exception::Raise"}}`
+
+func TestParseSymbols(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{
+			name:  "functions object",
+			input: symbolsJSON,
+		},
+		{
+			name:  "flat object",
+			input: `{"12":"Player_Update_m1234","345":"il2cpp::vm::Exception::Raise"}`,
+		},
+		{
+			name:  "symbol map",
+			input: "12:Player_Update_m1234\n345:il2cpp::vm::Exception::Raise\n",
+		},
+		{
+			name:  "invalid index",
+			input: `{"functions":{"main":"main"}}`,
+			err:   `invalid function index "main"`,
+		},
+		{
+			name:  "invalid symbol map",
+			input: "12:Player_Update_m1234\nmain\n",
+			err:   `line 2: invalid symbol "main"`,
+		},
+		{
+			name:  "empty",
+			input: "",
+			err:   "no symbols",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			symbols, err := unisrv.ParseSymbols(strings.NewReader(v.input))
+			switch {
+			case err != nil && err.Error() != v.err:
+				tt.Fatalf("expected %q, but got %q", v.err, err.Error())
+			case err == nil && v.err != "":
+				tt.Fatalf("unexpected success")
+			case err != nil:
+				return
+			default:
+				// nop
+			}
+
+			for index, expected := range map[int]string{12: "Player_Update_m1234", 345: "il2cpp::vm::Exception::Raise"} {
+				if name, ok := symbols.Lookup(index); !ok || name != expected {
+					tt.Errorf("expected %q, but got %q", expected, name)
+				}
+			}
+		})
+	}
+}
+
+func TestSymbolicate(t *testing.T) {
+	symbols, err := unisrv.ParseSymbols(strings.NewReader(symbolsJSON))
+	if err != nil {
+		t.Fatalf("parse failed: %+v", err)
+	}
+
+	trace := "Error: boom\n" +
+		"    at wasm://wasm/0123abcd:wasm-function[345]:0x1a2b\n" +
+		"    at wasm://wasm/0123abcd:wasm-function[12]:0x3c4d\n" +
+		"    at wasm://wasm/0123abcd:wasm-function[999]:0x5e6f\n"
+	expected := "Error: boom\n" +
+		"    at wasm://wasm/0123abcd:il2cpp::vm::Exception::Raise:0x1a2b\n" +
+		"    at wasm://wasm/0123abcd:Player_Update_m1234:0x3c4d\n" +
+		"    at wasm://wasm/0123abcd:wasm-function[999]:0x5e6f\n"
+
+	if actual := symbols.Symbolicate(trace); actual != expected {
+		t.Errorf("expected %q, but got %q", expected, actual)
+	}
+}
+
+func TestSymbolsUpdate(t *testing.T) {
+	cases := []struct {
+		name     string
+		other    string
+		expected string
+	}{
+		{
+			name:     "symbols",
+			other:    "12:Player_Start_m5678\n",
+			expected: "Player_Start_m5678",
+		},
+		{
+			name:     "nil",
+			expected: "",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			symbols, err := unisrv.ParseSymbols(strings.NewReader(symbolsJSON))
+			if err != nil {
+				tt.Fatalf("unexpected error: %+v", err)
+			}
+
+			var other *unisrv.Symbols
+			if v.other != "" {
+				if other, err = unisrv.ParseSymbols(strings.NewReader(v.other)); err != nil {
+					tt.Fatalf("unexpected error: %+v", err)
+				}
+			}
+
+			symbols.Update(other)
+
+			if name, _ := symbols.Lookup(12); name != v.expected {
+				tt.Errorf("expected %q, but got %q", v.expected, name)
+			}
+			if name, ok := symbols.Lookup(345); ok {
+				tt.Errorf("expected the old symbol to be removed, but got %q", name)
+			}
+		})
+	}
+}
+
+func TestLoadSymbols(t *testing.T) {
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	io.WriteString(zw, symbolsJSON) //nolint:errcheck
+	zw.Close()
+
+	cases := []struct {
+		name     string
+		fsys     fs.FS
+		expected string
+		notExist bool
+	}{
+		{
+			name: "uncompressed",
+			fsys: fstest.MapFS{
+				"Build/Build.symbols.json": {Data: []byte(symbolsJSON)},
+			},
+			expected: "Build/Build.symbols.json",
+		},
+		{
+			name: "compressed",
+			fsys: fstest.MapFS{
+				"Build/Build.data.gz":         {Data: []byte("data")},
+				"Build/Build.symbols.json.gz": {Data: gzipped.Bytes()},
+			},
+			expected: "Build/Build.symbols.json.gz",
+		},
+		{
+			name: "unityweb",
+			fsys: fstest.MapFS{
+				"Build/Build.symbols.json.unityweb": {Data: gzipped.Bytes()},
+			},
+			expected: "Build/Build.symbols.json.unityweb",
+		},
+		{
+			name: "not found",
+			fsys: fstest.MapFS{
+				"Build/Build.data": {Data: []byte("data")},
+			},
+			notExist: true,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			name, err := unisrv.FindSymbols(v.fsys)
+			if v.notExist {
+				if !errors.Is(err, fs.ErrNotExist) {
+					tt.Errorf("expected fs.ErrNotExist, but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("find failed: %+v", err)
+			}
+			if name != v.expected {
+				tt.Errorf("expected %q, but got %q", v.expected, name)
+			}
+
+			symbols, err := unisrv.LoadSymbols(v.fsys, name)
+			if err != nil {
+				tt.Fatalf("load failed: %+v", err)
+			}
+			if name, ok := symbols.Lookup(12); !ok || name != "Player_Update_m1234" {
+				tt.Errorf("expected %q, but got %q", "Player_Update_m1234", name)
+			}
+		})
+	}
+}
+
+func TestNewHandlerSymbolicate(t *testing.T) {
+	symbols, err := unisrv.ParseSymbols(strings.NewReader(symbolsJSON))
+	if err != nil {
+		t.Fatalf("parse failed: %+v", err)
+	}
+
+	h := unisrv.NewHandler("testdata", &unisrv.Options{
+		Base:    "/base/",
+		Symbols: symbols,
+	})
+
+	cases := []struct {
+		name       string
+		method     string
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{
+			name:       "post",
+			method:     http.MethodPost,
+			body:       "at wasm-function[12]:0x10",
+			statusCode: http.StatusOK,
+			expected:   "at Player_Update_m1234:0x10",
+		},
+		{
+			name:       "get",
+			method:     http.MethodGet,
+			statusCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			r := httptest.NewRequest(v.method, "/base/__unisrv/symbolicate", strings.NewReader(v.body))
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			tt.Run("status code", func(ttt *testing.T) {
+				if resp.StatusCode != v.statusCode {
+					ttt.Errorf("expected %d, but got %d", v.statusCode, resp.StatusCode)
+				}
+			})
+
+			if v.statusCode != http.StatusOK {
+				return
+			}
+
+			tt.Run("body", func(ttt *testing.T) {
+				b, err := io.ReadAll(resp.Body)
+				if err != nil {
+					ttt.Fatalf("read failed: %+v", err)
+				}
+				if string(b) != v.expected {
+					ttt.Errorf("expected %q, but got %q", v.expected, string(b))
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package unisrv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// IsMultithreaded reports whether the Unity application in fsys looks built with
+// "Enable native C/C++ multithreading", which requires cross-origin isolation.
+//
+// It looks for the pthread worker script or the pthread runtime in the framework script.
+func IsMultithreaded(fsys fs.FS) (bool, error) {
+	found := false
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		base := trimCompressionExt(path.Base(name))
+		switch {
+		case strings.HasSuffix(base, ".worker.js"):
+			found = true
+		case strings.HasSuffix(base, ".framework.js"), strings.HasSuffix(base, ".wasm.framework"):
+			found, err = containsPThread(fsys, name)
+			if err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		if found {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("walk: %w", err)
+	}
+
+	return found, nil
+}
+
+// containsPThread reports whether the named framework script contains the pthread runtime of Emscripten.
+func containsPThread(fsys fs.FS, name string) (bool, error) {
+	r, err := openDecoded(fsys, name)
+	if err != nil {
+		return false, fmt.Errorf("open %s: %w", name, err)
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", name, err)
+	}
+
+	return bytes.Contains(b, []byte("PThread")), nil
+}
+
+// trimCompressionExt removes the compression extension from the file name.
+func trimCompressionExt(name string) string {
+	ext := path.Ext(name)
+	if ext == unitywebExt || codingByExt(ext) != nil {
+		return strings.TrimSuffix(name, ext)
+	}
+	return name
+}
@@ -0,0 +1,82 @@
+package unisrv_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/frozenbonito/unisrv"
+)
+
+func TestIsMultithreaded(t *testing.T) {
+	gzipped := func(s string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(s)) //nolint:errcheck
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	cases := []struct {
+		name     string
+		fsys     fs.FS
+		expected bool
+	}{
+		{
+			name:     "testdata",
+			fsys:     os.DirFS("testdata"),
+			expected: false,
+		},
+		{
+			name: "worker script",
+			fsys: fstest.MapFS{
+				"Build/Build.worker.js": {Data: []byte("worker")},
+			},
+			expected: true,
+		},
+		{
+			name: "uncompressed framework with pthread",
+			fsys: fstest.MapFS{
+				"Build/Build.framework.js": {Data: []byte("var PThread = {};")},
+			},
+			expected: true,
+		},
+		{
+			name: "compressed framework with pthread",
+			fsys: fstest.MapFS{
+				"Build/Build.framework.js.gz": {Data: gzipped("var PThread = {};")},
+			},
+			expected: true,
+		},
+		{
+			name: "unityweb framework with pthread",
+			fsys: fstest.MapFS{
+				"Build/Build.framework.js.unityweb": {Data: gzipped("var PThread = {};")},
+			},
+			expected: true,
+		},
+		{
+			name: "framework without pthread",
+			fsys: fstest.MapFS{
+				"Build/Build.framework.js.gz": {Data: gzipped("var Module = {};")},
+			},
+			expected: false,
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			threaded, err := unisrv.IsMultithreaded(v.fsys)
+			if err != nil {
+				tt.Fatalf("unexpected error: %+v", err)
+			}
+
+			if threaded != v.expected {
+				tt.Errorf("expected %v, but got %v", v.expected, threaded)
+			}
+		})
+	}
+}
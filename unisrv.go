@@ -2,68 +2,203 @@
 package unisrv
 
 import (
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
 	"net/http"
 	"path"
 	"strings"
 )
 
-// NewHandler returns a handler that serves Unity application.
+// NewHandler returns a handler that serves Unity application in the directory.
 func NewHandler(dir string, opts *Options) http.Handler {
+	return newHandler(http.Dir(dir), opts)
+}
+
+// NewHandlerFS returns a handler that serves Unity application in the file system.
+//
+// It can be used to serve Unity application embedded with `go:embed`.
+func NewHandlerFS(fsys fs.FS, opts *Options) http.Handler {
+	return newHandler(http.FS(fsys), opts)
+}
+
+// newHandler returns a handler that serves Unity application in root.
+func newHandler(root http.FileSystem, opts *Options) http.Handler {
 	if opts == nil {
 		opts = &Options{}
 	}
 
-	h := http.FileServer(http.Dir(dir))
+	endpoints := make(map[string]http.Handler)
+	var scripts []string
+	if opts.LiveReload != nil {
+		endpoints[liveReloadPath] = opts.LiveReload
+		scripts = append(scripts, fmt.Sprintf(liveReloadScript, internalPath(opts.Base, liveReloadPath)))
+	}
+	if opts.Symbols != nil {
+		endpoints[symbolicatePath] = opts.Symbols
+	}
+	if opts.ForwardConsole != nil {
+		endpoints[consolePath] = consoleHandler(opts.ForwardConsole)
+		scripts = append(scripts, fmt.Sprintf(consoleScript, internalPath(opts.Base, consolePath)))
+	}
+
+	h := http.FileServer(root)
+	if opts.ETag {
+		h = contentETags(root, h)
+	}
+	h = UnityMiddleware(h)
+	h = precompressedSiblings(root, h)
+	h = injectScripts(scripts, h)
+	h = routeInternal(endpoints, h)
 
 	if opts.Base != "" && opts.Base != "/" {
 		h = http.StripPrefix(opts.Base, h)
 	}
 
-	h = UnityMiddleware(h)
+	h = cacheControl(opts.CacheRules, opts.NoCache, opts.Base, h)
+	h = corsMiddleware(opts.CORS, h)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if opts.NoCache {
-			w.Header().Set("Cache-Control", "no-cache")
+		if opts.CrossOriginIsolation != "" {
+			w.Header().Set("Cross-Origin-Opener-Policy", "same-origin")
+			w.Header().Set("Cross-Origin-Embedder-Policy", string(opts.CrossOriginIsolation))
+			w.Header().Set("Cross-Origin-Resource-Policy", "same-origin")
 		}
 		h.ServeHTTP(w, r)
 	})
 }
 
 // UnityMiddleware is a middleware for serving Unity application.
+//
+// Precompressed assets are served with `Content-Encoding` header if the client accepts the encoding.
+// Otherwise, they are decompressed on the fly and re-encoded with gzip if the client accepts it.
+// Strong ETags of the files are adjusted for the transcoded representations.
+// The encoding of `.unityweb` and extensionless assets is detected from their content,
+// which is probed by serving a GET request to next before the actual request.
 func UnityMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		contentEncoding, contentType := contentHeaders(r)
-		if contentEncoding != "" {
-			w.Header().Set("Content-Encoding", contentEncoding)
+		sniffing := contentEncoding == "" && needsSniffing(r.URL.Path)
+		if sniffing {
+			if coding := sniffNext(next, r); coding != nil {
+				contentEncoding = coding.name
+				if contentType == "" {
+					// Content-Type sniffed by http.FileServer would describe the compressed content.
+					contentType = "application/octet-stream"
+				}
+			}
 		}
 		if contentType != "" {
 			w.Header().Set("Content-Type", contentType)
 		}
-		next.ServeHTTP(w, r)
+
+		switch {
+		case contentEncoding != "":
+			w = &assetHeadersWriter{ResponseWriter: w, contentType: contentType}
+			w.Header().Add("Vary", "Accept-Encoding")
+			w.Header().Set("Content-Encoding", contentEncoding)
+
+			if acceptsEncoding(r, contentEncoding) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tw := newTranscodingWriter(w, codingByName(contentEncoding), acceptsEncoding(r, "gzip"))
+			serveWithWriter(next, tw, trimETagVariant(r, tw.variant()))
+		case sniffing:
+			w.Header().Add("Vary", "Accept-Encoding")
+			next.ServeHTTP(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
 	})
 }
 
+// assetHeadersWriter is a http.ResponseWriter that removes `Content-Encoding` and `Content-Type` headers
+// set for the asset from error responses, whose body is not the asset.
+type assetHeadersWriter struct {
+	http.ResponseWriter
+	contentType string
+}
+
+func (s *assetHeadersWriter) WriteHeader(code int) {
+	if code >= http.StatusBadRequest {
+		h := s.Header()
+		h.Del("Content-Encoding")
+		if s.contentType != "" && h.Get("Content-Type") == s.contentType {
+			h.Del("Content-Type")
+		}
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (s *assetHeadersWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// bodyRewriter is a http.ResponseWriter that may alter the response body.
+// Close must be called after the handler returns.
+type bodyRewriter interface {
+	http.ResponseWriter
+	io.Closer
+}
+
+// serveWithWriter calls next with the bodyRewriter and then closes it.
+func serveWithWriter(next http.Handler, w bodyRewriter, r *http.Request) {
+	// Byte ranges of the stored file are meaningless for the altered body.
+	r = r.Clone(r.Context())
+	r.Header.Del("Range")
+	r.Header.Del("If-Range")
+
+	next.ServeHTTP(w, r)
+	if err := w.Close(); err != nil {
+		// Abort the response so that the client does not take the broken body as complete.
+		panic(http.ErrAbortHandler)
+	}
+}
+
 // contentHeaders returns values of `Content-Encoding` and `Content-Type` response headers
 // for serving Unity application.
 func contentHeaders(r *http.Request) (contentEncoding, contentType string) {
 	ext := path.Ext(r.URL.Path)
-	switch ext {
-	case ".br":
-		contentEncoding = "br"
-	case ".gz":
-		contentEncoding = "gzip"
-	default:
+	original := strings.TrimSuffix(r.URL.Path, ext)
+
+	if ext == unitywebExt {
+		contentType = unityContentType(original)
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
 		return
 	}
 
-	original := strings.TrimSuffix(r.URL.Path, ext)
-	switch {
-	case strings.HasSuffix(original, ".data"), strings.HasSuffix(original, ".symbols.json"):
-		contentType = "application/octet-stream"
-	case strings.HasSuffix(original, ".js"):
-		contentType = "application/javascript"
-	case strings.HasSuffix(original, ".wasm"):
-		contentType = "application/wasm"
+	coding := codingByExt(ext)
+	if coding == nil {
+		return
 	}
+	contentEncoding = coding.name
+	contentType = unityContentType(original)
 	return
 }
+
+// unityContentType returns a value of `Content-Type` header for the Unity asset
+// whose name has no compression extension.
+func unityContentType(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".data"),
+		strings.HasSuffix(name, ".symbols.json"),
+		strings.HasSuffix(name, ".asm.memory"):
+		return "application/octet-stream"
+	case strings.HasSuffix(name, ".js"),
+		strings.HasSuffix(name, ".wasm.framework"),
+		strings.HasSuffix(name, ".asm.framework"),
+		strings.HasSuffix(name, ".asm.code"):
+		return "application/javascript"
+	case strings.HasSuffix(name, ".wasm"),
+		strings.HasSuffix(name, ".wasm.code"):
+		return "application/wasm"
+	default:
+		return mime.TypeByExtension(path.Ext(name))
+	}
+}
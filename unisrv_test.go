@@ -1,9 +1,14 @@
 package unisrv_test
 
 import (
+	"compress/gzip"
+	"embed"
 	"fmt"
+	"io"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path"
 	"strings"
 	"testing"
@@ -11,7 +16,77 @@ import (
 	"github.com/frozenbonito/unisrv"
 )
 
+//go:embed testdata
+var embedded embed.FS
+
 func TestNewHandler(t *testing.T) {
+	newHandler := func(opts *unisrv.Options) http.Handler {
+		return unisrv.NewHandler("testdata", opts)
+	}
+
+	t.Run("headers", func(tt *testing.T) {
+		testNewHandler(tt, newHandler)
+	})
+
+	t.Run("transcoding", func(tt *testing.T) {
+		testTranscoding(tt, newHandler)
+	})
+
+	t.Run("precompressed siblings", func(tt *testing.T) {
+		testPrecompressedSiblings(tt, newHandler)
+	})
+
+	t.Run("sniffing", func(tt *testing.T) {
+		testSniffing(tt, newHandler)
+	})
+}
+
+func TestNewHandlerFS(t *testing.T) {
+	sub, err := fs.Sub(embedded, "testdata")
+	if err != nil {
+		t.Fatalf("failed to create sub file system: %+v", err)
+	}
+
+	filesystems := []struct {
+		name string
+		fsys fs.FS
+	}{
+		{
+			name: "os.DirFS",
+			fsys: os.DirFS("testdata"),
+		},
+		{
+			name: "embed.FS",
+			fsys: sub,
+		},
+	}
+
+	for _, v := range filesystems {
+		t.Run(v.name, func(tt *testing.T) {
+			newHandler := func(opts *unisrv.Options) http.Handler {
+				return unisrv.NewHandlerFS(v.fsys, opts)
+			}
+
+			tt.Run("headers", func(ttt *testing.T) {
+				testNewHandler(ttt, newHandler)
+			})
+
+			tt.Run("transcoding", func(ttt *testing.T) {
+				testTranscoding(ttt, newHandler)
+			})
+
+			tt.Run("precompressed siblings", func(ttt *testing.T) {
+				testPrecompressedSiblings(ttt, newHandler)
+			})
+
+			tt.Run("sniffing", func(ttt *testing.T) {
+				testSniffing(ttt, newHandler)
+			})
+		})
+	}
+}
+
+func testNewHandler(t *testing.T, newHandler func(opts *unisrv.Options) http.Handler) {
 	cases := []struct {
 		name    string
 		opts    *unisrv.Options
@@ -85,7 +160,7 @@ func TestNewHandler(t *testing.T) {
 
 	for _, v := range cases {
 		t.Run(v.name, func(tt *testing.T) {
-			h := unisrv.NewHandler("testdata", v.opts)
+			h := newHandler(v.opts)
 
 			base := "/"
 			if v.opts != nil && v.opts.Base != "" {
@@ -171,6 +246,26 @@ func TestUnityMiddleware(t *testing.T) {
 			contentEncoding: "br",
 			contentType:     "application/wasm",
 		},
+		{
+			path:            "/Build/Build.data.zst",
+			contentEncoding: "zstd",
+			contentType:     "application/octet-stream",
+		},
+		{
+			path:            "/Build/Build.symbols.json.zst",
+			contentEncoding: "zstd",
+			contentType:     "application/octet-stream",
+		},
+		{
+			path:            "/Build/Build.framework.js.zst",
+			contentEncoding: "zstd",
+			contentType:     "application/javascript",
+		},
+		{
+			path:            "/Build/Build.wasm.zst",
+			contentEncoding: "zstd",
+			contentType:     "application/wasm",
+		},
 		{
 			path:            "/Build/Build.data.gz",
 			contentEncoding: "gzip",
@@ -229,3 +324,538 @@ func TestUnityMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestUnityMiddlewareError(t *testing.T) {
+	cases := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		handler        http.HandlerFunc
+		contentType    string
+	}{
+		{
+			name:           "not found",
+			path:           "/Build/Build.wasm.br",
+			acceptEncoding: "identity",
+			handler:        http.NotFound,
+			contentType:    "text/plain; charset=utf-8",
+		},
+		{
+			name:           "not found with encoding accepted",
+			path:           "/Build/Build.wasm.br",
+			acceptEncoding: "br",
+			handler:        http.NotFound,
+			contentType:    "text/plain; charset=utf-8",
+		},
+		{
+			name:           "internal server error without body",
+			path:           "/Build/Build.wasm.gz",
+			acceptEncoding: "identity",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			contentType: "",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, v.path, nil)
+			r.Header.Set("Accept-Encoding", v.acceptEncoding)
+			w := httptest.NewRecorder()
+
+			unisrv.UnityMiddleware(v.handler).ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			tt.Run("Content-Encoding header", func(ttt *testing.T) {
+				if contentEncoding := resp.Header.Get("Content-Encoding"); contentEncoding != "" {
+					ttt.Errorf("expected %q, but got %q", "", contentEncoding)
+				}
+			})
+
+			tt.Run("Content-Type header", func(ttt *testing.T) {
+				if contentType := resp.Header.Get("Content-Type"); contentType != v.contentType {
+					ttt.Errorf("expected %q, but got %q", v.contentType, contentType)
+				}
+			})
+		})
+	}
+}
+
+func testTranscoding(t *testing.T, newHandler func(opts *unisrv.Options) http.Handler) {
+	cases := []struct {
+		name            string
+		path            string
+		acceptEncoding  []string
+		contentEncoding string
+	}{
+		{
+			name:            "no Accept-Encoding header",
+			path:            "/Build/Build.wasm.br",
+			acceptEncoding:  nil,
+			contentEncoding: "br",
+		},
+		{
+			name:            "br accepted",
+			path:            "/Build/Build.wasm.br",
+			acceptEncoding:  []string{"gzip, deflate, br"},
+			contentEncoding: "br",
+		},
+		{
+			name:            "br not accepted",
+			path:            "/Build/Build.wasm.br",
+			acceptEncoding:  []string{"gzip, deflate"},
+			contentEncoding: "gzip",
+		},
+		{
+			name:            "br rejected by quality value",
+			path:            "/Build/Build.wasm.br",
+			acceptEncoding:  []string{"br;q=0, *"},
+			contentEncoding: "gzip",
+		},
+		{
+			name:            "identity only",
+			path:            "/Build/Build.wasm.br",
+			acceptEncoding:  []string{"identity"},
+			contentEncoding: "",
+		},
+		{
+			name:            "empty Accept-Encoding header",
+			path:            "/Build/Build.wasm.br",
+			acceptEncoding:  []string{""},
+			contentEncoding: "",
+		},
+		{
+			name:            "wildcard rejected",
+			path:            "/Build/Build.wasm.br",
+			acceptEncoding:  []string{"*;q=0, identity"},
+			contentEncoding: "",
+		},
+		{
+			name:            "zstd accepted",
+			path:            "/Build/Build.wasm.zst",
+			acceptEncoding:  []string{"gzip, deflate, br, zstd"},
+			contentEncoding: "zstd",
+		},
+		{
+			name:            "zstd not accepted",
+			path:            "/Build/Build.wasm.zst",
+			acceptEncoding:  []string{"gzip, deflate, br"},
+			contentEncoding: "gzip",
+		},
+		{
+			name:            "zstd with identity only",
+			path:            "/Build/Build.wasm.zst",
+			acceptEncoding:  []string{"identity"},
+			contentEncoding: "",
+		},
+	}
+
+	h := newHandler(nil)
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, v.path, nil)
+			if v.acceptEncoding != nil {
+				r.Header["Accept-Encoding"] = v.acceptEncoding
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			tt.Run("status code", func(ttt *testing.T) {
+				if resp.StatusCode != http.StatusOK {
+					ttt.Errorf("expected %d, but got %d", http.StatusOK, resp.StatusCode)
+				}
+			})
+
+			tt.Run("Content-Encoding header", func(ttt *testing.T) {
+				contentEncoding := resp.Header.Get("Content-Encoding")
+				if contentEncoding != v.contentEncoding {
+					ttt.Errorf("expected %q, but got %q", v.contentEncoding, contentEncoding)
+				}
+			})
+
+			tt.Run("Content-Type header", func(ttt *testing.T) {
+				expected := "application/wasm"
+				contentType := resp.Header.Get("Content-Type")
+				if contentType != expected {
+					ttt.Errorf("expected %q, but got %q", expected, contentType)
+				}
+			})
+
+			tt.Run("Vary header", func(ttt *testing.T) {
+				expected := "Accept-Encoding"
+				vary := resp.Header.Get("Vary")
+				if vary != expected {
+					ttt.Errorf("expected %q, but got %q", expected, vary)
+				}
+			})
+
+			if v.contentEncoding != "" && v.contentEncoding != "gzip" {
+				return
+			}
+
+			tt.Run("body", func(ttt *testing.T) {
+				var body io.Reader = resp.Body
+				if v.contentEncoding == "gzip" {
+					zr, err := gzip.NewReader(resp.Body)
+					if err != nil {
+						ttt.Fatalf("failed to create gzip reader: %+v", err)
+					}
+					defer zr.Close()
+					body = zr
+				}
+
+				b, err := io.ReadAll(body)
+				if err != nil {
+					ttt.Fatalf("read failed: %+v", err)
+				}
+
+				expected := "testdata\n"
+				if string(b) != expected {
+					ttt.Errorf("expected %q, but got %q", expected, string(b))
+				}
+			})
+		})
+	}
+}
+
+func testPrecompressedSiblings(t *testing.T, newHandler func(opts *unisrv.Options) http.Handler) {
+	cases := []struct {
+		name            string
+		path            string
+		acceptEncoding  []string
+		statusCode      int
+		contentEncoding string
+		contentType     string
+	}{
+		{
+			name:            "no Accept-Encoding header",
+			path:            "/Build/Build.wasm",
+			acceptEncoding:  nil,
+			statusCode:      http.StatusOK,
+			contentEncoding: "br",
+			contentType:     "application/wasm",
+		},
+		{
+			name:            "br preferred",
+			path:            "/Build/Build.wasm",
+			acceptEncoding:  []string{"gzip, br"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "br",
+			contentType:     "application/wasm",
+		},
+		{
+			name:            "zstd sibling",
+			path:            "/Build/Build.wasm",
+			acceptEncoding:  []string{"gzip, zstd"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "zstd",
+			contentType:     "application/wasm",
+		},
+		{
+			name:            "gzip sibling",
+			path:            "/Build/Build.wasm",
+			acceptEncoding:  []string{"gzip"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "gzip",
+			contentType:     "application/wasm",
+		},
+		{
+			name:            "decompression fallback",
+			path:            "/Build/Build.wasm",
+			acceptEncoding:  []string{"identity"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "",
+			contentType:     "application/wasm",
+		},
+		{
+			name:            "br only sibling",
+			path:            "/Build/Build.data",
+			acceptEncoding:  []string{"gzip"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "gzip",
+			contentType:     "application/octet-stream",
+		},
+		{
+			name:           "no sibling",
+			path:           "/Build/Build.unknown",
+			acceptEncoding: []string{"gzip, br"},
+			statusCode:     http.StatusNotFound,
+			contentType:    "text/plain; charset=utf-8",
+		},
+	}
+
+	h := newHandler(nil)
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, v.path, nil)
+			if v.acceptEncoding != nil {
+				r.Header["Accept-Encoding"] = v.acceptEncoding
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			tt.Run("status code", func(ttt *testing.T) {
+				if resp.StatusCode != v.statusCode {
+					ttt.Errorf("expected %d, but got %d", v.statusCode, resp.StatusCode)
+				}
+			})
+
+			tt.Run("Content-Encoding header", func(ttt *testing.T) {
+				contentEncoding := resp.Header.Get("Content-Encoding")
+				if contentEncoding != v.contentEncoding {
+					ttt.Errorf("expected %q, but got %q", v.contentEncoding, contentEncoding)
+				}
+			})
+
+			tt.Run("Content-Type header", func(ttt *testing.T) {
+				contentType := resp.Header.Get("Content-Type")
+				if contentType != v.contentType {
+					ttt.Errorf("expected %q, but got %q", v.contentType, contentType)
+				}
+			})
+		})
+	}
+}
+
+func testSniffing(t *testing.T, newHandler func(opts *unisrv.Options) http.Handler) {
+	cases := []struct {
+		name            string
+		method          string
+		path            string
+		rangeHeader     string
+		acceptEncoding  []string
+		statusCode      int
+		contentEncoding string
+		contentType     string
+		body            string
+	}{
+		{
+			name:            "gzip unityweb",
+			method:          http.MethodGet,
+			path:            "/Build/Build.data.unityweb",
+			acceptEncoding:  []string{"gzip, br"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "gzip",
+			contentType:     "application/octet-stream",
+			body:            "",
+		},
+		{
+			name:            "brotli unityweb",
+			method:          http.MethodGet,
+			path:            "/Build/Build.wasm.unityweb",
+			acceptEncoding:  []string{"gzip, br"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "br",
+			contentType:     "application/wasm",
+			body:            "",
+		},
+		{
+			name:            "brotli unityweb not accepted",
+			method:          http.MethodGet,
+			path:            "/Build/Build.wasm.unityweb",
+			acceptEncoding:  []string{"identity"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "",
+			contentType:     "application/wasm",
+			body:            "testdata\n",
+		},
+		{
+			name:            "uncompressed unityweb",
+			method:          http.MethodGet,
+			path:            "/Build/Build.framework.js.unityweb",
+			acceptEncoding:  []string{"gzip, br"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "",
+			contentType:     "application/javascript",
+			body:            "testdata\n",
+		},
+		{
+			name:            "extensionless gzip asset",
+			method:          http.MethodGet,
+			path:            "/Build/asset",
+			acceptEncoding:  []string{"gzip, br"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "gzip",
+			contentType:     "application/octet-stream",
+			body:            "",
+		},
+		{
+			name:            "extensionless gzip asset not accepted",
+			method:          http.MethodGet,
+			path:            "/Build/asset",
+			acceptEncoding:  []string{"br"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "",
+			contentType:     "application/octet-stream",
+			body:            "testdata\n",
+		},
+		{
+			name:            "extensionless gzip asset with HEAD",
+			method:          http.MethodHead,
+			path:            "/Build/asset",
+			acceptEncoding:  []string{"gzip, br"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "gzip",
+			contentType:     "application/octet-stream",
+			body:            "",
+		},
+		{
+			name:            "extensionless gzip asset not accepted with HEAD",
+			method:          http.MethodHead,
+			path:            "/Build/asset",
+			acceptEncoding:  []string{"br"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "",
+			contentType:     "application/octet-stream",
+			body:            "",
+		},
+		{
+			name:            "range of uncompressed unityweb",
+			method:          http.MethodGet,
+			path:            "/Build/Build.framework.js.unityweb",
+			rangeHeader:     "bytes=0-3",
+			acceptEncoding:  []string{"gzip, br"},
+			statusCode:      http.StatusPartialContent,
+			contentEncoding: "",
+			contentType:     "application/javascript",
+			body:            "test",
+		},
+		{
+			name:            "range of extensionless gzip asset not accepted",
+			method:          http.MethodGet,
+			path:            "/Build/asset",
+			rangeHeader:     "bytes=0-3",
+			acceptEncoding:  []string{"br"},
+			statusCode:      http.StatusOK,
+			contentEncoding: "",
+			contentType:     "application/octet-stream",
+			body:            "testdata\n",
+		},
+	}
+
+	h := newHandler(nil)
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			r := httptest.NewRequest(v.method, v.path, nil)
+			r.Header["Accept-Encoding"] = v.acceptEncoding
+			if v.rangeHeader != "" {
+				r.Header.Set("Range", v.rangeHeader)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			tt.Run("status code", func(ttt *testing.T) {
+				if resp.StatusCode != v.statusCode {
+					ttt.Errorf("expected %d, but got %d", v.statusCode, resp.StatusCode)
+				}
+			})
+
+			tt.Run("Content-Encoding header", func(ttt *testing.T) {
+				contentEncoding := resp.Header.Get("Content-Encoding")
+				if contentEncoding != v.contentEncoding {
+					ttt.Errorf("expected %q, but got %q", v.contentEncoding, contentEncoding)
+				}
+			})
+
+			tt.Run("Content-Type header", func(ttt *testing.T) {
+				contentType := resp.Header.Get("Content-Type")
+				if contentType != v.contentType {
+					ttt.Errorf("expected %q, but got %q", v.contentType, contentType)
+				}
+			})
+
+			if v.contentEncoding != "" {
+				return
+			}
+
+			tt.Run("body", func(ttt *testing.T) {
+				b, err := io.ReadAll(resp.Body)
+				if err != nil {
+					ttt.Fatalf("read failed: %+v", err)
+				}
+
+				if string(b) != v.body {
+					ttt.Errorf("expected %q, but got %q", v.body, string(b))
+				}
+			})
+		})
+	}
+}
+
+func TestNewHandlerCrossOriginIsolation(t *testing.T) {
+	cases := []struct {
+		name      string
+		isolation unisrv.CrossOriginIsolation
+		coop      string
+		coep      string
+		corp      string
+	}{
+		{
+			name:      "disabled",
+			isolation: "",
+		},
+		{
+			name:      "require-corp",
+			isolation: unisrv.CrossOriginIsolationRequireCorp,
+			coop:      "same-origin",
+			coep:      "require-corp",
+			corp:      "same-origin",
+		},
+		{
+			name:      "credentialless",
+			isolation: unisrv.CrossOriginIsolationCredentialless,
+			coop:      "same-origin",
+			coep:      "credentialless",
+			corp:      "same-origin",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(tt *testing.T) {
+			h := unisrv.NewHandler("testdata", &unisrv.Options{
+				CrossOriginIsolation: v.isolation,
+			})
+
+			for _, target := range []string{"/", "/Build/Build.wasm.br", "/not-found"} {
+				tt.Run(target, func(ttt *testing.T) {
+					r := httptest.NewRequest(http.MethodGet, target, nil)
+					w := httptest.NewRecorder()
+
+					h.ServeHTTP(w, r)
+
+					resp := w.Result()
+					defer resp.Body.Close()
+
+					headers := map[string]string{
+						"Cross-Origin-Opener-Policy":   v.coop,
+						"Cross-Origin-Embedder-Policy": v.coep,
+						"Cross-Origin-Resource-Policy": v.corp,
+					}
+					for key, expected := range headers {
+						if actual := resp.Header.Get(key); actual != expected {
+							ttt.Errorf("%s: expected %q, but got %q", key, expected, actual)
+						}
+					}
+				})
+			}
+		})
+	}
+}